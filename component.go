@@ -0,0 +1,146 @@
+package mongolog
+
+// Component is the functional component of mongod that logged the entry. The constants cover the
+// components of the mongod versions up to 5.0, newer ones are kept as they were logged.
+type Component string
+
+const (
+	ComponentDefault  Component = "-"
+	ComponentAccess   Component = "ACCESS"
+	ComponentAssert   Component = "ASSERT"
+	ComponentCommand  Component = "COMMAND"
+	ComponentControl  Component = "CONTROL"
+	ComponentExecutor Component = "EXECUTOR"
+	ComponentFTDC     Component = "FTDC"
+	ComponentGeo      Component = "GEO"
+	ComponentIndex    Component = "INDEX"
+	ComponentNetwork  Component = "NETWORK"
+	ComponentTest     Component = "TEST"
+	ComponentTracking Component = "TRACKING"
+	ComponentQuery    Component = "QUERY"
+	ComponentSharding Component = "SHARDING"
+	ComponentWrite    Component = "WRITE"
+	ComponentTxn      Component = "TXN"
+
+	ComponentReplication     Component = "REPL"
+	ComponentElection        Component = "ELECTION"
+	ComponentHeartbeats      Component = "REPL_HB"
+	ComponentInitialSync     Component = "INITSYNC"
+	ComponentRollback        Component = "ROLLBACK"
+	ComponentTenantMigration Component = "TENANT_M"
+
+	ComponentConnectionPool Component = "CONNPOOL"
+	ComponentASIO           Component = "ASIO"
+	ComponentBridge         Component = "BRIDGE"
+
+	ComponentCatalogRefresh Component = "SH_REFR"
+	ComponentMigration      Component = "MIGRATE"
+	ComponentResharding     Component = "RESHARD"
+
+	ComponentStorage    Component = "STORAGE"
+	ComponentJournal    Component = "JOURNAL"
+	ComponentRecovery   Component = "RECOVERY"
+	ComponentWiredTiger Component = "WT"
+
+	ComponentWTBackup       Component = "WTBACKUP"
+	ComponentWTCheckpoint   Component = "WTCHKPT"
+	ComponentWTCompact      Component = "WTCMPCT"
+	ComponentWTEviction     Component = "WTEVICT"
+	ComponentWTHistoryStore Component = "WTHS"
+	ComponentWTRecovery     Component = "WTRECOV"
+	ComponentWTRollback     Component = "WTRTS"
+	ComponentWTSalvage      Component = "WTSLVG"
+	ComponentWTTiered       Component = "WTTIER"
+	ComponentWTTimestamp    Component = "WTTS"
+	ComponentWTTransaction  Component = "WTTXN"
+	ComponentWTVerify       Component = "WTVRFY"
+	ComponentWTWriteLog     Component = "WTWRTLOG"
+)
+
+// The parents of the sub-components, as in the systemLog.component verbosity settings, ie.
+// REPL_HB is replication.heartbeats. The top level components have the default as the parent.
+var componentParents = map[Component]Component{
+	ComponentAccess:   ComponentDefault,
+	ComponentAssert:   ComponentDefault,
+	ComponentCommand:  ComponentDefault,
+	ComponentControl:  ComponentDefault,
+	ComponentExecutor: ComponentDefault,
+	ComponentFTDC:     ComponentDefault,
+	ComponentGeo:      ComponentDefault,
+	ComponentIndex:    ComponentDefault,
+	ComponentNetwork:  ComponentDefault,
+	ComponentTest:     ComponentDefault,
+	ComponentTracking: ComponentDefault,
+	ComponentQuery:    ComponentDefault,
+	ComponentSharding: ComponentDefault,
+	ComponentWrite:    ComponentDefault,
+	ComponentTxn:      ComponentDefault,
+
+	ComponentReplication: ComponentDefault,
+	ComponentElection:    ComponentReplication,
+	ComponentHeartbeats:  ComponentReplication,
+	ComponentInitialSync: ComponentReplication,
+	ComponentRollback:    ComponentReplication,
+
+	ComponentTenantMigration: ComponentReplication,
+
+	ComponentConnectionPool: ComponentNetwork,
+	ComponentASIO:           ComponentNetwork,
+	ComponentBridge:         ComponentNetwork,
+
+	ComponentCatalogRefresh: ComponentSharding,
+	ComponentMigration:      ComponentSharding,
+	ComponentResharding:     ComponentSharding,
+
+	ComponentStorage:    ComponentDefault,
+	ComponentJournal:    ComponentStorage,
+	ComponentRecovery:   ComponentStorage,
+	ComponentWiredTiger: ComponentStorage,
+
+	ComponentWTBackup:       ComponentWiredTiger,
+	ComponentWTCheckpoint:   ComponentWiredTiger,
+	ComponentWTCompact:      ComponentWiredTiger,
+	ComponentWTEviction:     ComponentWiredTiger,
+	ComponentWTHistoryStore: ComponentWiredTiger,
+	ComponentWTRecovery:     ComponentWiredTiger,
+	ComponentWTRollback:     ComponentWiredTiger,
+	ComponentWTSalvage:      ComponentWiredTiger,
+	ComponentWTTiered:       ComponentWiredTiger,
+	ComponentWTTimestamp:    ComponentWiredTiger,
+	ComponentWTTransaction:  ComponentWiredTiger,
+	ComponentWTVerify:       ComponentWiredTiger,
+	ComponentWTWriteLog:     ComponentWiredTiger,
+}
+
+// Known returns true if the component is one of the constants
+func (c Component) Known() bool {
+	_, ok := componentParents[c]
+	return ok || c == ComponentDefault
+}
+
+// Parent returns the component that the sub-component belongs to, ie. REPL for REPL_HB. The
+// top level and unknown components have the default component "-" as the parent.
+func (c Component) Parent() Component {
+	if parent, ok := componentParents[c]; ok {
+		return parent
+	}
+	return ComponentDefault
+}
+
+// Is returns true if the component is the other component or one of its sub-components, ie.
+// REPL_HB is REPL. All the components are the default component.
+func (c Component) Is(other Component) bool {
+	for {
+		if c == other {
+			return true
+		}
+		if c == ComponentDefault {
+			return false
+		}
+		c = c.Parent()
+	}
+}
+
+func (c Component) String() string {
+	return string(c)
+}
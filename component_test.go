@@ -0,0 +1,94 @@
+package mongolog
+
+import (
+	"testing"
+)
+
+func TestComponentHierarchy(t *testing.T) {
+	testComponents := []struct {
+		component Component
+		other     Component
+		expect    bool
+	}{
+		{ComponentHeartbeats, ComponentReplication, true},
+		{ComponentReplication, ComponentHeartbeats, false},
+		{ComponentWTCheckpoint, ComponentWiredTiger, true},
+		{ComponentWTCheckpoint, ComponentStorage, true},
+		{ComponentWTCheckpoint, ComponentReplication, false},
+		{ComponentCommand, ComponentCommand, true},
+		{ComponentCommand, ComponentWrite, false},
+		{ComponentCommand, ComponentDefault, true},
+		{Component("FOO"), ComponentDefault, true},
+		{Component("FOO"), ComponentCommand, false},
+		{ComponentConnectionPool, ComponentNetwork, true},
+		{ComponentCatalogRefresh, ComponentSharding, true},
+		{ComponentTenantMigration, ComponentReplication, true},
+	}
+
+	for _, v := range testComponents {
+		if v.component.Is(v.other) != v.expect {
+			t.Errorf("%v.Is(%v): expected %v", v.component, v.other, v.expect)
+		}
+	}
+
+	if ComponentHeartbeats.Parent() != ComponentReplication || ComponentQuery.Parent() != ComponentDefault {
+		t.Errorf("unexpected parents")
+	}
+	if !ComponentHeartbeats.Known() || !ComponentDefault.Known() || Component("FOO").Known() {
+		t.Errorf("unexpected known components")
+	}
+}
+
+func TestParseLogEntrySeverity(t *testing.T) {
+	parser, _ := NewLogParser()
+	logLine := `2018-10-05T14:01:04.067+0000 W REPL_HB  [replexec-1] Heartbeat to mongo-2:27017 failed`
+
+	m, err := parser.Parse(logLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Severity != Warning || !m.Severity.AtLeast(Warning) || m.Severity.AtLeast(Error) {
+		t.Errorf("unexpected severity: %v", m.Severity)
+	}
+	if m.Component != ComponentHeartbeats || !m.Component.Is(ComponentReplication) {
+		t.Errorf("unexpected component: %v", m.Component)
+	}
+}
+
+func TestParseLogEntryDebugSeverity(t *testing.T) {
+	parser, _ := NewLogParser()
+	testMessages := []struct {
+		logLine   string
+		severity  Severity
+		verbosity int
+		component Component
+	}{
+		{
+			`2020-08-11T09:13:47.011+0000 D1 COMMAND  [conn12] run command admin.$cmd { isMaster: 1 }`,
+			Debug1, 1, ComponentCommand,
+		},
+		{
+			`2020-08-11T09:13:47.011+0000 D5 CONNPOOL [TaskExecutorPool-0] Updating controller for mongo-2:27017`,
+			Debug5, 5, ComponentConnectionPool,
+		},
+		{
+			`2020-08-11T09:13:47.011+0000 D2 SH_REFR  [ShardServerCatalogCacheLoader-0] Refresh for FooDb.foo`,
+			Debug2, 2, ComponentCatalogRefresh,
+		},
+	}
+
+	for _, v := range testMessages {
+		m, err := parser.Parse(v.logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", v.logLine, err)
+			continue
+		}
+		if m.Timestamp != "2020-08-11T09:13:47.011+0000" || m.Severity != v.severity ||
+			m.Severity.Verbosity() != v.verbosity || m.Component != v.component {
+			t.Errorf("unexpected entry: %v %v %v", m.Timestamp, m.Severity, m.Component)
+		}
+		if m.Severity.AtLeast(Info) || !m.Component.Known() {
+			t.Errorf("%v: unexpected severity or component", v.logLine)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package mongolog
+
+import (
+	"sync"
+)
+
+// ConnectionEvent tells whether the log entry opened, closed or identified a client connection
+type ConnectionEvent int
+
+const (
+	NoConnectionEvent ConnectionEvent = iota
+	ConnectionOpened
+	ConnectionClosed
+	// ConnectionIdentified is the client metadata of the connection
+	ConnectionIdentified
+)
+
+// ConnectionState keeps track of the open connections of a mongod, keyed by the log context
+// ([connNNN]). It is safe for concurrent use. The Connection values are never modified once
+// stored, updates replace them, so the entries can hold on to them without locking.
+type ConnectionState struct {
+	lock        sync.RWMutex
+	connections map[string]*Connection
+}
+
+func NewConnectionState() *ConnectionState {
+	return &ConnectionState{connections: make(map[string]*Connection)}
+}
+
+// Lookup returns the connection of the log context
+func (state *ConnectionState) Lookup(context string) (conn *Connection, ok bool) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	conn, ok = state.connections[context]
+	return
+}
+
+// Len returns the number of open connections
+func (state *ConnectionState) Len() int {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	return len(state.connections)
+}
+
+func (state *ConnectionState) open(conn *Connection) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.connections[conn.ConnectionId] = conn
+}
+
+func (state *ConnectionState) close(context string) (conn *Connection, ok bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if conn, ok = state.connections[context]; ok {
+		delete(state.connections, context)
+	}
+	return
+}
+
+// update replaces the connection of the context with a modified copy
+func (state *ConnectionState) update(context string, modify func(conn *Connection)) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if conn, ok := state.connections[context]; ok {
+		updated := *conn
+		modify(&updated)
+		state.connections[context] = &updated
+	}
+}
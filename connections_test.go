@@ -0,0 +1,79 @@
+package mongolog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentParse(t *testing.T) {
+	parser, err := NewLogParser()
+	if err != nil {
+		t.Fatalf("unable to initialize parser: %v", err)
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Every goroutine has its own connection so that the lines of a connection are in order
+			conn := fmt.Sprintf("%d", 1000+w)
+			lines := []string{
+				`2018-10-05T14:01:04.067+0000 I NETWORK  [listener] connection accepted from 10.0.0.` +
+					fmt.Sprint(w) + `:47878 #` + conn + ` (252 connections now open)`,
+				`2018-10-05T14:01:04.068+0000 I NETWORK  [conn` + conn + `] received client metadata` +
+					` from 10.0.0.1:47878 conn` + conn + `: { application: { name: "app` + fmt.Sprint(w) +
+					`" }, driver: { name: "mongo-go-driver", version: "v1.1.0" } }`,
+				`2018-10-05T14:01:04.069+0000 I COMMAND  [conn` + conn + `] command FooDb.foo command:` +
+					` find { find: "foo", filter: { a: 1 }, $db: "FooDb" } planSummary: COLLSCAN` +
+					` keysExamined:0 docsExamined:1 nreturned:1 reslen:100 locks:{} 1ms`,
+			}
+
+			for i := 0; i < 50; i++ {
+				for _, line := range lines {
+					m, err := parser.Parse(line)
+					if err != nil {
+						t.Errorf("unexpected error: %v: %v", line, err)
+						return
+					}
+					if m.ConnectionInfo == nil || m.ConnectionInfo.ConnectionId != "[conn"+conn+"]" {
+						t.Errorf("unexpected connection: %+v", m.ConnectionInfo)
+						return
+					}
+				}
+				m, _ := parser.Parse(lines[2])
+				if m.ConnectionInfo.AppName != "app"+fmt.Sprint(w) {
+					t.Errorf("unexpected app name: %v", m.ConnectionInfo.AppName)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if n := parser.Connections().Len(); n != workers {
+		t.Errorf("expected %v connections, got %v", workers, n)
+	}
+}
+
+func TestSharedConnectionState(t *testing.T) {
+	state := NewConnectionState()
+	p1, _ := NewLogParserWithState(state)
+	p2, _ := NewLogParserWithState(state)
+
+	p1.Parse(`2018-10-05T14:01:04.067+0000 I NETWORK  [listener] connection accepted from` +
+		` 10.0.0.1:47878 #42 (1 connection now open)`)
+	m, err := p2.Parse(`2018-10-05T14:01:04.069+0000 I NETWORK  [conn42] end connection` +
+		` 10.0.0.1:47878 (0 connections now open)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.ConnectionInfo == nil || m.ConnectionInfo.IpAddress != "10.0.0.1" {
+		t.Errorf("connection not shared: %+v", m.ConnectionInfo)
+	}
+	if state.Len() != 0 {
+		t.Errorf("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,247 @@
+package mongolog
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConnectionRecord is the lifecycle of a client connection as seen in the log
+type ConnectionRecord struct {
+	// Connection is the latest state of the connection, with the client metadata if it was sent.
+	// For the connections opened before the log starts only the ConnectionId is known, and the
+	// client address once the connection is closed.
+	Connection *Connection
+	// Opened and Closed are zero if the log doesn't have them, or their timestamps failed to parse
+	Opened time.Time
+	Closed time.Time
+	// Commands is the number of logged operations on the connection, CommandTime their total
+	// duration
+	Commands    int
+	CommandTime time.Duration
+}
+
+// Duration returns how long the connection was open, 0 if it wasn't both opened and closed in
+// the log
+func (r *ConnectionRecord) Duration() time.Duration {
+	if r.Opened.IsZero() || r.Closed.IsZero() {
+		return 0
+	}
+	return r.Closed.Sub(r.Opened)
+}
+
+// ConnectionSummary aggregates the connections of a client IP or an application
+type ConnectionSummary struct {
+	Key string
+	// Opened and Closed are the number of connections opened and closed in the log
+	Opened int
+	Closed int
+	// Connections is the number of connections seen, including the ones open at the log start
+	Connections int
+	// TotalDuration is the total duration of the connections both opened and closed in the log
+	TotalDuration time.Duration
+	Commands      int
+	CommandTime   time.Duration
+
+	completed int
+}
+
+// MeanDuration returns the average duration of the connections both opened and closed in the log
+func (s *ConnectionSummary) MeanDuration() time.Duration {
+	if s.completed == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.completed)
+}
+
+func (s *ConnectionSummary) add(r *ConnectionRecord) {
+	s.Connections++
+	if !r.Opened.IsZero() {
+		s.Opened++
+	}
+	if !r.Closed.IsZero() {
+		s.Closed++
+	}
+	if !r.Opened.IsZero() && !r.Closed.IsZero() {
+		s.TotalDuration += r.Duration()
+		s.completed++
+	}
+	s.Commands += r.Commands
+	s.CommandTime += r.CommandTime
+}
+
+// ChurnInterval is the number of connections opened and closed in the interval starting at Start
+type ChurnInterval struct {
+	Start    time.Time
+	Interval time.Duration
+	Opened   int
+	Closed   int
+}
+
+// Rate returns the number of connections opened per second in the interval
+func (c ChurnInterval) Rate() float64 {
+	return float64(c.Opened) / c.Interval.Seconds()
+}
+
+// ConnectionTracker records the lifecycle of the client connections from the parsed log entries.
+// The entries must be added in the log order. It is not safe for concurrent use.
+type ConnectionTracker struct {
+	interval time.Duration
+	// The open connections by the log context, and all of the connections in the order seen
+	open    map[string]*ConnectionRecord
+	records []*ConnectionRecord
+	// The churn by the interval start, in Unix nanoseconds as the times can be in different zones
+	churn map[int64]*ChurnInterval
+}
+
+// NewConnectionTracker returns a tracker that counts the connection churn in the given intervals,
+// a minute if interval is not positive
+func NewConnectionTracker(interval time.Duration) *ConnectionTracker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &ConnectionTracker{
+		interval: interval,
+		open:     make(map[string]*ConnectionRecord),
+		churn:    make(map[int64]*ChurnInterval),
+	}
+}
+
+// Add records the connection event or the operation of the entry
+func (tracker *ConnectionTracker) Add(entry *MongoLogEntry) {
+	if entry.ConnectionEvent == ConnectionOpened {
+		id := entry.ConnectionInfo.ConnectionId
+		// A connection id is reused after a restart, the old connection is gone without a trace
+		delete(tracker.open, id)
+		record := tracker.record(id, entry)
+		record.Opened = entry.Time
+		tracker.countChurn(entry.Time, true)
+		return
+	}
+	if !strings.HasPrefix(entry.Context, "[conn") {
+		return
+	}
+
+	record := tracker.record(entry.Context, entry)
+	switch entry.ConnectionEvent {
+	case ConnectionClosed:
+		record.Closed = entry.Time
+		tracker.countChurn(entry.Time, false)
+		delete(tracker.open, entry.Context)
+	case NoConnectionEvent:
+		if entry.ExecStats != nil {
+			record.Commands++
+			record.CommandTime += entry.ExecStats.Duration
+		}
+	}
+}
+
+// record returns the record of the open connection, creating it if there's none. The connection
+// state is taken from the entry, it has the latest metadata.
+func (tracker *ConnectionTracker) record(key string, entry *MongoLogEntry) *ConnectionRecord {
+	record, ok := tracker.open[key]
+	if !ok {
+		record = &ConnectionRecord{Connection: &Connection{ConnectionId: key}}
+		tracker.open[key] = record
+		tracker.records = append(tracker.records, record)
+	}
+	if entry.ConnectionInfo != nil {
+		record.Connection = entry.ConnectionInfo
+	}
+	return record
+}
+
+// countChurn counts the connection opened or closed at t. The entries without a timestamp, ie.
+// the ones with an unparseable timestamp, are left out of the churn.
+func (tracker *ConnectionTracker) countChurn(t time.Time, opened bool) {
+	if t.IsZero() {
+		return
+	}
+
+	start := t.Truncate(tracker.interval)
+	churn, ok := tracker.churn[start.UnixNano()]
+	if !ok {
+		churn = &ChurnInterval{Start: start, Interval: tracker.interval}
+		tracker.churn[start.UnixNano()] = churn
+	}
+	if opened {
+		churn.Opened++
+	} else {
+		churn.Closed++
+	}
+}
+
+// Connections returns the records of all the connections seen, in the order they were first seen
+func (tracker *ConnectionTracker) Connections() []*ConnectionRecord {
+	return tracker.records
+}
+
+// Open returns the number of connections that are open at the end of the log
+func (tracker *ConnectionTracker) Open() int {
+	return len(tracker.open)
+}
+
+// ByClientIP returns the connection summaries by the client IP address, the most connections
+// first. The connections that were open at the log start and not closed have an empty IP.
+func (tracker *ConnectionTracker) ByClientIP() []*ConnectionSummary {
+	return tracker.summarize(func(conn *Connection) string { return conn.IpAddress })
+}
+
+// ByAppName returns the connection summaries by the application name of the client metadata,
+// the most connections first. The clients that didn't send the name have an empty key.
+func (tracker *ConnectionTracker) ByAppName() []*ConnectionSummary {
+	return tracker.summarize(func(conn *Connection) string { return conn.AppName })
+}
+
+func (tracker *ConnectionTracker) summarize(key func(conn *Connection) string) []*ConnectionSummary {
+	summaries := make(map[string]*ConnectionSummary)
+	for _, r := range tracker.records {
+		k := key(r.Connection)
+		s, ok := summaries[k]
+		if !ok {
+			s = &ConnectionSummary{Key: k}
+			summaries[k] = s
+		}
+		s.add(r)
+	}
+
+	result := make([]*ConnectionSummary, 0, len(summaries))
+	for _, s := range summaries {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Connections != result[j].Connections {
+			return result[i].Connections > result[j].Connections
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// Churn returns the number of connections opened and closed per interval, from the first to the
+// last interval with connection events. The intervals without any are included with zero counts.
+func (tracker *ConnectionTracker) Churn() []ChurnInterval {
+	if len(tracker.churn) == 0 {
+		return nil
+	}
+
+	var first, last *ChurnInterval
+	for _, churn := range tracker.churn {
+		if first == nil || churn.Start.Before(first.Start) {
+			first = churn
+		}
+		if last == nil || churn.Start.After(last.Start) {
+			last = churn
+		}
+	}
+
+	var result []ChurnInterval
+	for start := first.Start; !start.After(last.Start); start = start.Add(tracker.interval) {
+		if churn, ok := tracker.churn[start.UnixNano()]; ok {
+			result = append(result, *churn)
+		} else {
+			result = append(result, ChurnInterval{Start: start, Interval: tracker.interval})
+		}
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package mongolog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnectionTracker(t *testing.T) {
+	open := func(ts string, ip string, id int) string {
+		return fmt.Sprintf(`2018-10-05T14:%v+0000 I NETWORK  [listener] connection accepted from %v:47878`+
+			` #%d (1 connection now open)`, ts, ip, id)
+	}
+	metadata := func(ts string, id int, app string) string {
+		return fmt.Sprintf(`2018-10-05T14:%v+0000 I NETWORK  [conn%d] received client metadata from`+
+			` 10.0.0.1:47878 conn%d: { application: { name: "%v" }, driver: { name: "PyMongo",`+
+			` version: "3.11.0" } }`, ts, id, id, app)
+	}
+	command := func(ts string, id int, millis int) string {
+		return fmt.Sprintf(`2018-10-05T14:%v+0000 I COMMAND  [conn%d] command FooDb.foo command: find`+
+			` { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1`+
+			` nreturned:1 reslen:100 locks:{} %dms`, ts, id, millis)
+	}
+	end := func(ts string, id int) string {
+		return fmt.Sprintf(`2018-10-05T14:%v+0000 I NETWORK  [conn%d] end connection 10.0.0.1:47878`+
+			` (0 connections now open)`, ts, id)
+	}
+
+	lines := []string{
+		command("00:00.000", 7, 100),
+		open("00:01.000", "10.0.0.1", 1),
+		metadata("00:01.001", 1, "catpics"),
+		command("00:02.000", 1, 100),
+		command("00:03.000", 1, 200),
+		open("00:30.000", "10.0.0.1", 2),
+		metadata("00:30.001", 2, "catpics"),
+		end("00:45.000", 2),
+		open("03:00.000", "10.0.0.2", 3),
+		end("03:10.000", 1),
+		end("03:20.000", 7),
+	}
+
+	tracker := NewConnectionTracker(time.Minute)
+	parser, _ := NewLogParser()
+	for _, line := range lines {
+		m, err := parser.Parse(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v: %v", line, err)
+		}
+		tracker.Add(&m)
+	}
+
+	records := tracker.Connections()
+	if len(records) != 4 || tracker.Open() != 1 {
+		t.Fatalf("expected 4 connections with 1 open, got %v and %v", len(records), tracker.Open())
+	}
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.Connection.ConnectionId)
+	}
+	if strings.Join(ids, " ") != "[conn7] [conn1] [conn2] [conn3]" {
+		t.Errorf("unexpected connections: %v", ids)
+	}
+
+	conn7, conn1, conn2 := records[0], records[1], records[2]
+	if !conn7.Opened.IsZero() || conn7.Closed.IsZero() || conn7.Duration() != 0 || conn7.Commands != 1 ||
+		conn7.Connection.IpAddress != "10.0.0.1" || conn7.Connection.Port != "47878" {
+		t.Errorf("unexpected connection 7: %+v", conn7)
+	}
+	if conn1.Duration() != 189*time.Second || conn1.Commands != 2 || conn1.CommandTime != 300*time.Millisecond ||
+		conn1.Connection.AppName != "catpics" || conn1.Connection.IpAddress != "10.0.0.1" {
+		t.Errorf("unexpected connection 1: %+v %+v", conn1, conn1.Connection)
+	}
+	if conn2.Duration() != 15*time.Second || conn2.Commands != 0 {
+		t.Errorf("unexpected connection 2: %+v", conn2)
+	}
+
+	byIP := tracker.ByClientIP()
+	expectIP := []string{"10.0.0.1 3 2 3 1m42s 3", "10.0.0.2 1 1 0 0s 0"}
+	if len(byIP) != len(expectIP) {
+		t.Fatalf("unexpected summaries: %v", byIP)
+	}
+	for i, s := range byIP {
+		got := fmt.Sprintf("%v %d %d %d %v %d", s.Key, s.Connections, s.Opened, s.Closed, s.MeanDuration(), s.Commands)
+		if got != expectIP[i] {
+			t.Errorf("expected %v, got %v", expectIP[i], got)
+		}
+	}
+
+	byApp := tracker.ByAppName()
+	if len(byApp) != 2 || byApp[0].Key != "" || byApp[0].Connections != 2 ||
+		byApp[1].Key != "catpics" || byApp[1].Connections != 2 || byApp[1].CommandTime != 300*time.Millisecond {
+		t.Errorf("unexpected app summaries: %+v %+v", byApp[0], byApp[1])
+	}
+
+	churn := tracker.Churn()
+	var got []string
+	for _, c := range churn {
+		got = append(got, fmt.Sprintf("%v %d %d", c.Start.Format("15:04"), c.Opened, c.Closed))
+	}
+	if strings.Join(got, ", ") != "14:00 2 1, 14:01 0 0, 14:02 0 0, 14:03 1 2" {
+		t.Errorf("unexpected churn: %v", got)
+	}
+	if rate := churn[0].Rate(); rate != 2.0/60 {
+		t.Errorf("unexpected churn rate: %v", rate)
+	}
+}
+
+func TestConnectionTrackerZeroTime(t *testing.T) {
+	lines := []string{
+		`2018-13-45T14:00:01.000+0000 I NETWORK  [listener] connection accepted from 10.0.0.1:47878 #1` +
+			` (1 connection now open)`,
+		`2018-10-05T14:00:01.000+0000 I NETWORK  [listener] connection accepted from 10.0.0.1:47879 #2` +
+			` (2 connections now open)`,
+		`2018-13-45T14:01:01.000+0000 I NETWORK  [conn1] end connection 10.0.0.1:47878 (1 connection now open)`,
+	}
+
+	tracker := NewConnectionTracker(time.Minute)
+	parser, _ := NewLogParserWithOptions(LogParserOptions{Lenient: true})
+	for _, line := range lines {
+		m, err := parser.Parse(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v: %v", line, err)
+		}
+		tracker.Add(&m)
+	}
+
+	churn := tracker.Churn()
+	if len(churn) != 1 || churn[0].Opened != 1 || churn[0].Closed != 0 {
+		t.Errorf("unexpected churn: %+v", churn)
+	}
+	records := tracker.Connections()
+	if len(records) != 2 || !records[0].Opened.IsZero() || records[0].Duration() != 0 || tracker.Open() != 1 {
+		t.Errorf("unexpected connections: %v %+v", len(records), records[0])
+	}
+}
+
+func TestConnectionTrackerUnknownClose(t *testing.T) {
+	lines := []string{
+		`2018-10-05T14:00:01.000+0000 I NETWORK  [conn7] end connection 10.0.0.7:47878 (1 connection now open)`,
+		`{"t":{"$date":"2020-08-11T09:13:48.000+00:00"},"s":"I",  "c":"NETWORK",  "id":22944,` +
+			`   "ctx":"conn12","msg":"Connection ended","attr":{"remote":"10.0.0.12:47879","connectionId":12,` +
+			`"connectionCount":0}}`,
+	}
+
+	tracker := NewConnectionTracker(time.Minute)
+	parser, _ := NewLogParser()
+	for _, line := range lines {
+		m, err := parser.Parse(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v: %v", line, err)
+		}
+		tracker.Add(&m)
+	}
+
+	var got []string
+	for _, s := range tracker.ByClientIP() {
+		got = append(got, fmt.Sprintf("%v %d %d", s.Key, s.Connections, s.Closed))
+	}
+	if strings.Join(got, ", ") != "10.0.0.12 1 1, 10.0.0.7 1 1" {
+		t.Errorf("unexpected summaries: %v", got)
+	}
+	if records := tracker.Connections(); records[1].Connection.ConnectionId != "[conn12]" ||
+		records[1].Connection.Port != "47879" {
+		t.Errorf("unexpected connection: %+v", records[1].Connection)
+	}
+}
@@ -0,0 +1,139 @@
+package mongolog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// ParseStage is the part of the log entry that failed to parse
+type ParseStage string
+
+const (
+	StageHeader        ParseStage = "header"
+	StageConnection    ParseStage = "connection"
+	StageCommandInfo   ParseStage = "commandinfo"
+	StageCommandParams ParseStage = "commandparams"
+	StagePlanSummary   ParseStage = "plansummary"
+	StageLocks         ParseStage = "locks"
+)
+
+// Width of the log line shown on either side of the error position in the snippet
+const snippetContext = 40
+
+// ParseError is returned when a log line, or a part of it, can't be parsed
+type ParseError struct {
+	Stage ParseStage
+	// Offset is the byte offset of the error in the log line. If the exact position isn't known
+	// it's the start of the part that failed, and -1 if even that isn't known, ie. for the parts
+	// of the JSON logs. For the errors of ParsePseudoJson and ParsePlanSummary the offset is
+	// relative to the message they were given.
+	Offset int
+	// Token is the offending token, if known
+	Token string
+	// Line is the log line, or the message given to ParsePseudoJson and ParsePlanSummary
+	Line string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	var msg strings.Builder
+	if e.Stage != "" {
+		msg.WriteString(string(e.Stage) + ": ")
+	}
+	msg.WriteString("parse error")
+	if e.Offset >= 0 {
+		fmt.Fprintf(&msg, " at offset %d", e.Offset)
+	}
+	if e.Token != "" {
+		fmt.Fprintf(&msg, " near %q", e.Token)
+	}
+	msg.WriteString(": " + e.Err.Error())
+	return msg.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the part of the line around the error and a caret pointing at the offset:
+//
+//	...: { a: 1, b: [ 1, 2, ] } planSummary: ...
+//	                        ^
+func (e *ParseError) Snippet() string {
+	if e.Offset < 0 || e.Offset > len(e.Line) {
+		return ""
+	}
+
+	start, end := e.Offset-snippetContext, e.Offset+snippetContext
+	prefix, suffix := "...", "..."
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(e.Line) {
+		end, suffix = len(e.Line), ""
+	}
+
+	line := prefix + e.Line[start:end] + suffix
+	caret := strings.Repeat(" ", len(prefix)+e.Offset-start) + "^"
+	return line + "\n" + caret
+}
+
+// newParseError makes a ParseError of the stage from the error of parsing a part of the log
+// message at offset. Errors of the sub-parsers are relative to the part, others are placed at its
+// start.
+func newParseError(stage ParseStage, entry *MongoLogEntry, offset int, err error) *ParseError {
+	result := &ParseError{Stage: stage, Offset: -1, Err: err}
+
+	relative := 0
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		relative, result.Token, result.Err = perr.Offset, perr.Token, perr.Err
+	}
+
+	if entry.messageOffset >= 0 && offset >= 0 && relative >= 0 {
+		result.Offset = entry.messageOffset + offset + relative
+	}
+	return result
+}
+
+// asParseError makes a ParseError of the sub-parser errors, with the offset relative to the input
+func asParseError(input string, err error) error {
+	var participleErr participle.Error
+	if errors.As(err, &participleErr) {
+		offset := participleErr.Position().Offset
+		return &ParseError{
+			Offset: offset,
+			Token:  tokenAt(input, offset),
+			Line:   input,
+			Err:    errors.New(participleMessage(participleErr)),
+		}
+	}
+	return err
+}
+
+// participleMessage strips the line:column prefix from the participle errors
+func participleMessage(err participle.Error) string {
+	switch e := err.(type) {
+	case *lexer.Error:
+		return e.Message
+	case participle.UnexpectedTokenError:
+		return "unexpected token"
+	}
+	return err.Error()
+}
+
+// tokenAt returns the token at the offset of the input
+func tokenAt(input string, offset int) string {
+	if offset < 0 || offset >= len(input) {
+		return ""
+	}
+	tokens, _ := tokenize(input[offset:], make([]token, 0, 1))
+	if len(tokens) == 0 {
+		return ""
+	}
+	return input[offset+tokens[0].start : offset+tokens[0].end]
+}
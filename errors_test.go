@@ -0,0 +1,100 @@
+package mongolog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	testMessages := []struct {
+		logLine string
+		stage   ParseStage
+		token   string
+	}{
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.foo command: find` +
+				` { find: "foo", filter: { a: [ 1, 2 % ] }, $db: "FooDb" } planSummary: COLLSCAN` +
+				` keysExamined:0 docsExamined:1 nreturned:1 reslen:100 locks:{} 1ms`,
+			stage: StageCommandParams,
+			token: "%",
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.foo command: find` +
+				` { find: "foo", filter: { a: 1 }, $db: "FooDb" } planSummary: IXSCAN { a: % }` +
+				` keysExamined:0 docsExamined:1 nreturned:1 reslen:100 locks:{} 1ms`,
+			stage: StagePlanSummary,
+			token: "%",
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.foo command: find` +
+				` { find: "foo" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nreturned:1` +
+				` reslen:100 locks:{ Global: { acquireCount: { r: ? } } } 1ms`,
+			stage: StageLocks,
+			token: "?",
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] update FooDb.foo query: { a: 1 }` +
+				` planSummary: COLLSCAN update: { $set: { b: #1 } } keysExamined:0 docsExamined:1` +
+				` nMatched:1 nModified:1 numYields:0 locks:{} 0ms`,
+			stage: StageCommandParams,
+			token: "#",
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I NETWORK  [conn1] received client metadata from` +
+				` 10.0.0.1:47878 conn1: { driver: { name: * } }`,
+			stage: StageConnection,
+			token: "*",
+		},
+		{
+			logLine: `garbage`,
+			stage:   StageHeader,
+			token:   "garbage",
+		},
+	}
+
+	for _, fast := range []bool{false, true} {
+		parser, _ := NewLogParserWithOptions(LogParserOptions{FastPseudoJson: fast})
+		for _, v := range testMessages {
+			m, err := parser.Parse(v.logLine)
+			if err == nil && len(m.Warnings) > 0 {
+				// The lock stats and client metadata that fail to parse are warnings in the strict mode too
+				err = m.Warnings[0]
+			}
+
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Errorf("expected a ParseError, got %v", err)
+				continue
+			}
+			if perr.Stage != v.stage || perr.Token != v.token || perr.Line != v.logLine {
+				t.Errorf("unexpected error: %+v", perr)
+			}
+			if perr.Offset < 0 || !strings.HasPrefix(v.logLine[perr.Offset:], v.token) {
+				t.Errorf("offset %v does not point at %q: %v", perr.Offset, v.token, perr)
+			}
+		}
+	}
+}
+
+func TestParseErrorSnippet(t *testing.T) {
+	line := strings.Repeat("x", 50) + "{ a: ! }" + strings.Repeat("y", 50)
+	perr := &ParseError{Stage: StageCommandParams, Offset: 55, Token: "!", Line: line,
+		Err: errors.New("unexpected token")}
+
+	expect := "..." + strings.Repeat("x", 35) + "{ a: ! }" + strings.Repeat("y", 37) + "...\n" +
+		strings.Repeat(" ", 43) + "^"
+	if s := perr.Snippet(); s != expect {
+		t.Errorf("unexpected snippet:\n%v\nexpected:\n%v", s, expect)
+	}
+
+	expectError := `commandparams: parse error at offset 55 near "!": unexpected token`
+	if perr.Error() != expectError {
+		t.Errorf("unexpected error message: %v", perr)
+	}
+
+	perr = &ParseError{Offset: 1, Line: "{?", Err: errors.New("unexpected token")}
+	if s := perr.Snippet(); s != "{?\n ^" {
+		t.Errorf("unexpected snippet:\n%v", s)
+	}
+}
@@ -0,0 +1,81 @@
+package mongolog
+
+import (
+	"strconv"
+	"time"
+)
+
+// ExecStats are the execution statistics that Mongo logs for slow operations
+type ExecStats struct {
+	KeysExamined    int64
+	DocsExamined    int64
+	NReturned       int64
+	NumYields       int64
+	ResLen          int64
+	CursorExhausted bool
+	HasSortStage    bool
+	WriteConflicts  int64
+	NMatched        int64
+	NModified       int64
+	NInserted       int64
+	NDeleted        int64
+	Duration        time.Duration
+	Protocol        string
+}
+
+// set assigns a named counter, unknown names are ignored
+func (stats *ExecStats) set(name string, value int64) {
+	switch name {
+	case "keysExamined":
+		stats.KeysExamined = value
+	case "docsExamined":
+		stats.DocsExamined = value
+	case "nreturned":
+		stats.NReturned = value
+	case "numYields":
+		stats.NumYields = value
+	case "reslen":
+		stats.ResLen = value
+	case "cursorExhausted":
+		stats.CursorExhausted = value != 0
+	case "hasSortStage":
+		stats.HasSortStage = value != 0
+	case "writeConflicts":
+		stats.WriteConflicts = value
+	case "nMatched":
+		stats.NMatched = value
+	case "nModified":
+		stats.NModified = value
+	case "ninserted":
+		stats.NInserted = value
+	case "ndeleted":
+		stats.NDeleted = value
+	}
+}
+
+// ParseExecStats extracts the execution statistics from the log message. Returns nil if the
+// message doesn't end with the operation duration, ie. it's not a slow operation log line.
+func ParseExecStats(message string) *ExecStats {
+	duration := RegexpMatch(MongoDurationRegex, message)
+	if duration == nil {
+		return nil
+	}
+
+	stats := &ExecStats{}
+	millis, _ := strconv.ParseInt(duration["duration"], 10, 64)
+	stats.Duration = time.Duration(millis) * time.Millisecond
+
+	if protocol := RegexpMatch(MongoProtocolRegex, message); protocol != nil {
+		stats.Protocol = protocol["protocol"]
+	}
+
+	// The key-value pairs in the documents are always followed by a space, the stats are not
+	for _, match := range MongoExecStatRegex.FindAllStringSubmatch(message, -1) {
+		value, err := strconv.ParseInt(match[2], 10, 64)
+		if err == nil {
+			stats.set(match[1], value)
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,79 @@
+package mongolog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExecStats(t *testing.T) {
+	message := `command FooDb.mycatpicscollection command: find { find: "mycatpicscollection",` +
+		` filter: { nreturned: 5 } } planSummary: IXSCAN { nreturned: 1 }` +
+		` keysExamined:50314 docsExamined:2 hasSortStage:1 cursorExhausted:1 numYields:393 nreturned:2` +
+		` reslen:14980 locks:{ Global: { acquireCount: { r: 788 } } } protocol:op_query 219ms`
+
+	expectStats := ExecStats{
+		KeysExamined:    50314,
+		DocsExamined:    2,
+		NReturned:       2,
+		NumYields:       393,
+		ResLen:          14980,
+		CursorExhausted: true,
+		HasSortStage:    true,
+		Duration:        219 * time.Millisecond,
+		Protocol:        "op_query",
+	}
+	stats := ParseExecStats(message)
+	if stats == nil || *stats != expectStats {
+		t.Errorf("unexpected exec stats: %+v", stats)
+	}
+}
+
+func TestParseExecStatsWrite(t *testing.T) {
+	message := `update FooDb.mycatpicscollection query: { _id: 1 } planSummary: IDHACK` +
+		` update: { $set: { a: 1 } } keysExamined:1 docsExamined:1 nMatched:1 nModified:1` +
+		` writeConflicts:3 numYields:0 locks:{ Global: { acquireCount: { r: 1, w: 1 } } } 12ms`
+
+	expectStats := ExecStats{
+		KeysExamined:   1,
+		DocsExamined:   1,
+		NMatched:       1,
+		NModified:      1,
+		WriteConflicts: 3,
+		Duration:       12 * time.Millisecond,
+	}
+	stats := ParseExecStats(message)
+	if stats == nil || *stats != expectStats {
+		t.Errorf("unexpected exec stats: %+v", stats)
+	}
+}
+
+func TestParseExecStatsNoDuration(t *testing.T) {
+	if stats := ParseExecStats(`CMD: drop FooDb.mycatpicscollection`); stats != nil {
+		t.Errorf("expected no exec stats, got %+v", stats)
+	}
+}
+
+func TestParseLogEntryExecStatsAfterDocuments(t *testing.T) {
+	// The strings in the documents look like the stats, they must not override them
+	logLines := []string{
+		`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.mycatpicscollection` +
+			` command: find { find: "mycatpicscollection", filter: { a: 1 }, comment: "retry hasSortStage:1" }` +
+			` planSummary: IXSCAN { a: 1 } keysExamined:2 docsExamined:2 numYields:0 nreturned:2 reslen:300 2ms`,
+		`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] query FooDb.mycatpicscollection` +
+			` query: { a: 1, b: "x writeConflicts:7" } planSummary: IXSCAN { a: 1 } ntoreturn:0 keysExamined:2` +
+			` docsExamined:2 numYields:0 nreturned:2 reslen:300 2ms`,
+	}
+
+	parser, _ := NewLogParser()
+	for _, logLine := range logLines {
+		m, err := ParseLogEntry(parser, logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", logLine, err)
+			continue
+		}
+		if m.ExecStats == nil || m.ExecStats.NReturned != 2 || m.ExecStats.HasSortStage ||
+			m.ExecStats.WriteConflicts != 0 {
+			t.Errorf("unexpected exec stats: %+v", m.ExecStats)
+		}
+	}
+}
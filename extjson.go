@@ -0,0 +1,317 @@
+package mongolog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToExtendedJSON converts the document to MongoDB Extended JSON v2, either the canonical or the
+// relaxed form. Key order is preserved. A nil document is converted to null.
+func (doc *PseudoJson) ToExtendedJSON(canonical bool) ([]byte, error) {
+	if doc == nil {
+		return []byte("null"), nil
+	}
+	c := extJSONConverter{canonical: canonical, ordered: true}
+	result, err := c.document(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+// ToExtendedJSON converts the value to MongoDB Extended JSON v2. See PseudoJson.ToExtendedJSON.
+func (v *Value) ToExtendedJSON(canonical bool) ([]byte, error) {
+	c := extJSONConverter{canonical: canonical, ordered: true}
+	result, err := c.value(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+// ToMap converts the document to relaxed Extended JSON in the form of Go maps and slices, ie.
+// what json.Unmarshal would produce. Key order is lost and the first of the duplicate keys wins.
+// A nil document is converted to a nil map.
+func (doc *PseudoJson) ToMap() (map[string]interface{}, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	c := extJSONConverter{}
+	result, err := c.document(doc)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]interface{}), nil
+}
+
+// ToInterface converts the value to relaxed Extended JSON in the form of Go maps and slices
+func (v *Value) ToInterface() (interface{}, error) {
+	return extJSONConverter{}.value(v)
+}
+
+type docElem struct {
+	key   string
+	value interface{}
+}
+
+// orderedDoc marshals into a JSON object with the keys in original order
+type orderedDoc []docElem
+
+func (d orderedDoc) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range d {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type extJSONConverter struct {
+	canonical bool
+	ordered   bool
+}
+
+func (c extJSONConverter) makeDoc(elems ...docElem) interface{} {
+	if c.ordered {
+		return orderedDoc(elems)
+	}
+	m := make(map[string]interface{}, len(elems))
+	for _, e := range elems {
+		if _, ok := m[e.key]; !ok {
+			m[e.key] = e.value
+		}
+	}
+	return m
+}
+
+func (c extJSONConverter) document(doc *PseudoJson) (interface{}, error) {
+	elems := make([]docElem, 0, len(doc.Elements))
+	for _, e := range doc.Elements {
+		v, err := c.value(e.Val)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", e.Key, err)
+		}
+		elems = append(elems, docElem{e.Key, v})
+	}
+	return c.makeDoc(elems...), nil
+}
+
+func (c extJSONConverter) value(v *Value) (interface{}, error) {
+	switch v.Kind {
+	case KindNull:
+		return nil, nil
+	case KindString:
+		return v.StringValue, nil
+	case KindBool:
+		return v.BoolValue, nil
+	case KindNumber:
+		return c.number(v.NumericValue, v.Double), nil
+	case KindBinData:
+		return c.binary(v.BinDataValue.Subtype, v.BinDataValue.Data), nil
+	case KindFunction:
+		return c.function(v.FuncValue)
+	case KindRegex:
+		flags := strings.Split(v.RegexValue.Flags, "")
+		sort.Strings(flags)
+		return c.makeDoc(docElem{"$regularExpression", c.makeDoc(
+			docElem{"pattern", v.RegexValue.Pattern},
+			docElem{"options", strings.Join(flags, "")})}), nil
+	case KindArray:
+		result := make([]interface{}, 0, len(v.ArrayValue))
+		for pos, elem := range v.ArrayValue {
+			e, err := c.value(elem)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", pos, err)
+			}
+			result = append(result, e)
+		}
+		return result, nil
+	case KindDocument:
+		return c.document(v.Nested)
+	case KindRaw:
+		// Nothing better to do with it than keep the text
+		return v.StringValue, nil
+	}
+	return nil, fmt.Errorf("unknown value kind: %v", v.Kind)
+}
+
+// number converts the number to the Extended JSON number type, the integral numbers are $numberInt
+// or $numberLong in the canonical form unless they were logged as floats
+func (c extJSONConverter) number(n float64, double bool) interface{} {
+	if !c.canonical {
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return c.makeDoc(docElem{"$numberDouble", formatDouble(n)})
+		}
+		return n
+	}
+
+	if double {
+		return c.makeDoc(docElem{"$numberDouble", formatDouble(n)})
+	}
+	if n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32 {
+		return c.makeDoc(docElem{"$numberInt", strconv.FormatInt(int64(n), 10)})
+	}
+	if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+		return c.makeDoc(docElem{"$numberLong", strconv.FormatInt(int64(n), 10)})
+	}
+	return c.makeDoc(docElem{"$numberDouble", formatDouble(n)})
+}
+
+func formatDouble(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		return "-Infinity"
+	case math.IsNaN(n):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(n, 'G', -1, 64)
+	// Keep the integral doubles apart from the integers, as in the Extended JSON spec
+	if !strings.ContainsAny(s, ".E") {
+		s += ".0"
+	}
+	return s
+}
+
+func (c extJSONConverter) binary(subtype byte, data []byte) interface{} {
+	return c.makeDoc(docElem{"$binary", c.makeDoc(
+		docElem{"base64", base64.StdEncoding.EncodeToString(data)},
+		docElem{"subType", fmt.Sprintf("%02x", subtype)})})
+}
+
+func (c extJSONConverter) function(f *FunctionValue) (interface{}, error) {
+	switch f.FuncName {
+	case "ObjectId":
+		id, err := stringArg(f, 0)
+		if err != nil {
+			return nil, err
+		}
+		return c.makeDoc(docElem{"$oid", id}), nil
+
+	case "Date", "ISODate":
+		millis, err := dateArg(f)
+		if err != nil {
+			return nil, err
+		}
+		t := time.Unix(0, millis*int64(time.Millisecond)).UTC()
+		if c.canonical || t.Year() < 1970 || t.Year() > 9999 {
+			return c.makeDoc(docElem{"$date", c.makeDoc(
+				docElem{"$numberLong", strconv.FormatInt(millis, 10)})}), nil
+		}
+		return c.makeDoc(docElem{"$date", t.Format("2006-01-02T15:04:05.000Z07:00")}), nil
+
+	case "Timestamp":
+		seconds, err := intArg(f, 0)
+		if err != nil {
+			return nil, err
+		}
+		increment, err := intArg(f, 1)
+		if err != nil {
+			return nil, err
+		}
+		return c.makeDoc(docElem{"$timestamp", c.makeDoc(
+			docElem{"t", seconds}, docElem{"i", increment})}), nil
+
+	case "UUID":
+		id, err := stringArg(f, 0)
+		if err != nil {
+			return nil, err
+		}
+		data, err := hex.DecodeString(strings.Replace(id, "-", "", -1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid UUID: %v", id)
+		}
+		return c.binary(4, data), nil
+
+	case "NumberLong", "NumberInt":
+		n, err := intArg(f, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !c.canonical {
+			return n, nil
+		}
+		if f.FuncName == "NumberInt" {
+			return c.makeDoc(docElem{"$numberInt", strconv.FormatInt(n, 10)}), nil
+		}
+		return c.makeDoc(docElem{"$numberLong", strconv.FormatInt(n, 10)}), nil
+
+	case "NumberDecimal":
+		if len(f.FuncArgs) != 1 {
+			return nil, fmt.Errorf("NumberDecimal: expecting 1 argument")
+		}
+		arg := f.FuncArgs[0]
+		if arg.Kind == KindNumber {
+			return c.makeDoc(docElem{"$numberDecimal", formatDouble(arg.NumericValue)}), nil
+		}
+		s, err := stringArg(f, 0)
+		if err != nil {
+			return nil, err
+		}
+		return c.makeDoc(docElem{"$numberDecimal", s}), nil
+
+	case "MinKey":
+		return c.makeDoc(docElem{"$minKey", 1}), nil
+	case "MaxKey":
+		return c.makeDoc(docElem{"$maxKey", 1}), nil
+	}
+	return nil, fmt.Errorf("unsupported function: %v", f.FuncName)
+}
+
+func stringArg(f *FunctionValue, pos int) (string, error) {
+	if pos >= len(f.FuncArgs) || f.FuncArgs[pos].Kind != KindString {
+		return "", fmt.Errorf("%v: expecting a string argument at %d", f.FuncName, pos)
+	}
+	return f.FuncArgs[pos].StringValue, nil
+}
+
+// intArg accepts both numbers and numeric strings, ie. NumberLong(42) and NumberLong("42")
+func intArg(f *FunctionValue, pos int) (int64, error) {
+	if pos < len(f.FuncArgs) {
+		arg := f.FuncArgs[pos]
+		switch arg.Kind {
+		case KindNumber:
+			return int64(arg.NumericValue), nil
+		case KindString:
+			if n, err := strconv.ParseInt(arg.StringValue, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%v: expecting an integer argument at %d", f.FuncName, pos)
+}
+
+// dateArg returns the milliseconds since epoch of new Date(n) or ISODate("...")
+func dateArg(f *FunctionValue) (int64, error) {
+	if len(f.FuncArgs) == 1 && f.FuncArgs[0].Kind == KindString {
+		t, err := time.Parse(time.RFC3339Nano, f.FuncArgs[0].StringValue)
+		if err != nil {
+			return 0, fmt.Errorf("%v: %v", f.FuncName, err)
+		}
+		return t.UnixNano() / int64(time.Millisecond), nil
+	}
+	return intArg(f, 0)
+}
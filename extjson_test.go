@@ -0,0 +1,110 @@
+package mongolog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToExtendedJSON(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	testMessage := `{ find: "coll", filter: { _id: ObjectId('5a8c3a142053a407a936745e'), d: new Date(1538978461000),` +
+		` ts: Timestamp(1538978461, 14), u: UUID("c3cc9fef-182a-4917-9b5a-f715d0639ac2"), b: BinData(0, 0102),` +
+		` l: NumberLong(42), n: 1.5, i: 7, r: /^foo/mi, x: null, y: [ true, "s" ] }, $db: "FooDb" }`
+
+	msg, err := ParseCommandParameters(parser, testMessage)
+	if err != nil {
+		t.Errorf("unable to parse message: %v: %v\n", testMessage, err)
+		return
+	}
+
+	expectCanonical := `{"find":"coll","filter":{"_id":{"$oid":"5a8c3a142053a407a936745e"},` +
+		`"d":{"$date":{"$numberLong":"1538978461000"}},"ts":{"$timestamp":{"t":1538978461,"i":14}},` +
+		`"u":{"$binary":{"base64":"w8yf7xgqSRebWvcV0GOawg==","subType":"04"}},` +
+		`"b":{"$binary":{"base64":"AQI=","subType":"00"}},"l":{"$numberLong":"42"},` +
+		`"n":{"$numberDouble":"1.5"},"i":{"$numberInt":"7"},` +
+		`"r":{"$regularExpression":{"pattern":"^foo","options":"im"}},"x":null,"y":[true,"s"]},"$db":"FooDb"}`
+	canonical, err := msg.ToExtendedJSON(true)
+	if err != nil {
+		t.Errorf("canonical: unexpected error: %v", err)
+	} else if string(canonical) != expectCanonical {
+		t.Errorf("canonical mismatch:\nexpect: %v\nvalue : %s\n", expectCanonical, canonical)
+	}
+
+	expectRelaxed := `{"find":"coll","filter":{"_id":{"$oid":"5a8c3a142053a407a936745e"},` +
+		`"d":{"$date":"2018-10-08T06:01:01.000Z"},"ts":{"$timestamp":{"t":1538978461,"i":14}},` +
+		`"u":{"$binary":{"base64":"w8yf7xgqSRebWvcV0GOawg==","subType":"04"}},` +
+		`"b":{"$binary":{"base64":"AQI=","subType":"00"}},"l":42,"n":1.5,"i":7,` +
+		`"r":{"$regularExpression":{"pattern":"^foo","options":"im"}},"x":null,"y":[true,"s"]},"$db":"FooDb"}`
+	relaxed, err := msg.ToExtendedJSON(false)
+	if err != nil {
+		t.Errorf("relaxed: unexpected error: %v", err)
+	} else if string(relaxed) != expectRelaxed {
+		t.Errorf("relaxed mismatch:\nexpect: %v\nvalue : %s\n", expectRelaxed, relaxed)
+	}
+
+	m, err := msg.ToMap()
+	if err != nil {
+		t.Errorf("ToMap: unexpected error: %v", err)
+		return
+	}
+	var expectMap map[string]interface{}
+	if err := json.Unmarshal(relaxed, &expectMap); err != nil {
+		t.Errorf("cannot unmarshal relaxed: %v", err)
+		return
+	}
+	mapJson, _ := json.Marshal(m)
+	expectMapJson, _ := json.Marshal(expectMap)
+	if string(mapJson) != string(expectMapJson) {
+		t.Errorf("ToMap mismatch:\nexpect: %s\nvalue : %s\n", expectMapJson, mapJson)
+	}
+}
+
+func TestToExtendedJSONUnsupportedFunction(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	msg, err := ParseCommandParameters(parser, `{ a: Foo(1) }`)
+	if err != nil {
+		t.Errorf("unable to parse message: %v", err)
+		return
+	}
+
+	if _, err := msg.ToExtendedJSON(true); err == nil {
+		t.Errorf("expected an error for an unsupported function")
+	}
+}
+
+func TestToExtendedJSONNilDocument(t *testing.T) {
+	var doc *PseudoJson
+	if m, err := doc.ToMap(); m != nil || err != nil {
+		t.Errorf("expected a nil map, got %v %v", m, err)
+	}
+	if b, err := doc.ToExtendedJSON(false); string(b) != "null" || err != nil {
+		t.Errorf("expected null, got %s %v", b, err)
+	}
+}
+
+func TestToExtendedJSONDoubles(t *testing.T) {
+	slow, _ := NewPseudoJsonParser()
+	fast, _ := NewFastPseudoJsonParser()
+	expect := `{"a":{"$numberDouble":"1.0"},"b":{"$numberDouble":"55.0"},"c":{"$numberDouble":"-2.5"},` +
+		`"d":{"$numberInt":"55"},"e":{"$numberInt":"-3"}}`
+	for _, parser := range []MongoLogParser{slow, fast} {
+		msg, err := ParseCommandParameters(parser, `{ a: 1.0, b: 5.5e1, c: -2.5, d: 55, e: -3 }`)
+		if err != nil {
+			t.Errorf("unable to parse message: %v", err)
+			continue
+		}
+		if canonical, err := msg.ToExtendedJSON(true); err != nil || string(canonical) != expect {
+			t.Errorf("canonical mismatch:\nexpect: %v\nvalue : %s %v\n", expect, canonical, err)
+		}
+	}
+
+	// The JSON logs keep the floats and the $numberDouble wrappers too
+	doc, err := jsonToPseudoJson([]byte(`{"a":1.0,"b":{"$numberDouble":"2"},"c":3}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect = `{"a":{"$numberDouble":"1.0"},"b":{"$numberDouble":"2.0"},"c":{"$numberInt":"3"}}`
+	if canonical, err := doc.ToExtendedJSON(true); err != nil || string(canonical) != expect {
+		t.Errorf("canonical mismatch:\nexpect: %v\nvalue : %s %v\n", expect, canonical, err)
+	}
+}
@@ -0,0 +1,539 @@
+package mongolog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A hand-written lexer and recursive-descent parser for the same pseudo JSON dialect that the
+// participle grammar of PseudoJson accepts. It produces the same tree, with the scalars already
+// resolved, but without the reflection and backtracking overhead.
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokString
+	tokBinData
+	tokRegex
+	tokFloat
+	tokInt
+	tokIdent
+	tokPunct
+)
+
+var tokenTypeNames = []string{"EOF", "String", "BinData", "Regex", "Float", "Int", "Ident", "Punct"}
+
+func (t tokenType) String() string {
+	return tokenTypeNames[t]
+}
+
+type token struct {
+	typ        tokenType
+	start, end int
+}
+
+// Same as the BinData alternative of pseudoJsonLexer
+var binDataTokenRegex = regexp.MustCompile(`^BinData\(\s*\d+\s*,\s*(?:"[^"]*"|'[^']*'|[\w+/=]*)\s*\)`)
+
+// tokenize splits the message into tokens the same way as pseudoJsonLexer. The characters that the
+// lexer does not accept are returned as Punct tokens, with an error for the first of them.
+func tokenize(message string, tokens []token) (result []token, err error) {
+	pos := 0
+	for pos < len(message) {
+		c := message[pos]
+		start := pos
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pos++
+			continue
+
+		case c == '"' || c == '\'':
+			if end := scanString(message, pos); end > 0 {
+				tokens = append(tokens, token{tokString, start, end})
+				pos = end
+				continue
+			}
+
+		case c == '/':
+			if end := scanRegex(message, pos); end > 0 {
+				tokens = append(tokens, token{tokRegex, start, end})
+				pos = end
+				continue
+			}
+
+		case c >= '0' && c <= '9':
+			typ, end := scanNumber(message, pos)
+			tokens = append(tokens, token{typ, start, end})
+			pos = end
+			continue
+
+		case c == 'B' && strings.HasPrefix(message[pos:], "BinData("):
+			if loc := binDataTokenRegex.FindStringIndex(message[pos:]); loc != nil {
+				pos += loc[1]
+				tokens = append(tokens, token{tokBinData, start, pos})
+				continue
+			}
+		}
+
+		r, size := rune(c), 1
+		if c >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(message[pos:])
+		}
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+			pos += size
+			for pos < len(message) {
+				r, size := rune(message[pos]), 1
+				if r >= utf8.RuneSelf {
+					r, size = utf8.DecodeRuneInString(message[pos:])
+				}
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+					break
+				}
+				pos += size
+			}
+			tokens = append(tokens, token{tokIdent, start, pos})
+		case unicode.IsNumber(r):
+			if err == nil {
+				err = &ParseError{Offset: pos, Token: string(r), Line: message,
+					Err: fmt.Errorf("invalid character %q", r)}
+			}
+			fallthrough
+		default:
+			pos += size
+			tokens = append(tokens, token{tokPunct, start, pos})
+		}
+	}
+	return tokens, err
+}
+
+// scanString returns the end of the quoted string at pos, or 0 if it's not terminated
+func scanString(s string, pos int) int {
+	quote := s[pos]
+	for i := pos + 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return i + 1
+		case '\\':
+			// Escapes anything but a newline, same as \\. in the lexer regex
+			if i+1 < len(s) && s[i+1] == '\n' {
+				return 0
+			}
+			i++
+		}
+	}
+	return 0
+}
+
+// scanRegex returns the end of the regex literal at pos, including the flags, or 0 if there's none
+func scanRegex(s string, pos int) int {
+	i := pos + 1
+	for ; i < len(s) && s[i] != '/'; i++ {
+		switch s[i] {
+		case '\n':
+			return 0
+		case '\\':
+			if i+1 >= len(s) || s[i+1] == '\n' {
+				return 0
+			}
+			i++
+		}
+	}
+	if i >= len(s) || i == pos+1 {
+		return 0
+	}
+	for i++; i < len(s) && s[i] >= 'a' && s[i] <= 'z'; i++ {
+	}
+	return i
+}
+
+// scanNumber scans an Int or a Float starting at pos
+func scanNumber(s string, pos int) (tokenType, int) {
+	i := skipDigits(s, pos)
+	typ, end := tokInt, i
+
+	if i+1 < len(s) && s[i] == '.' && isDigit(s[i+1]) {
+		i = skipDigits(s, i+1)
+		typ, end = tokFloat, i
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			typ, end = tokFloat, skipDigits(s, j)
+		}
+	}
+	return typ, end
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func skipDigits(s string, pos int) int {
+	for pos < len(s) && isDigit(s[pos]) {
+		pos++
+	}
+	return pos
+}
+
+type fastParser struct {
+	message string
+	tokens  []token
+	pos     int
+
+	// In the lenient mode the values that fail to parse are kept as raw text and the errors
+	// collected into warnings
+	lenient  bool
+	warnings []error
+}
+
+// keyValue keeps the element and its value in a single allocation
+type keyValue struct {
+	kv  KeyValue
+	val Value
+}
+
+func parseFastPseudoJson(message string) (*PseudoJson, error) {
+	tokens, err := tokenize(message, make([]token, 0, len(message)/4))
+	if err != nil {
+		return nil, err
+	}
+
+	p := fastParser{message: message, tokens: tokens}
+	doc, err := p.document()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek(0).typ != tokEOF {
+		return nil, p.unexpected()
+	}
+	return doc, nil
+}
+
+// parseLenientPseudoJson parses what it can of the message. The values that can't be parsed are
+// returned as KindRaw values with the errors in warnings. Anything following the document is
+// ignored with a warning.
+func parseLenientPseudoJson(message string) (doc *PseudoJson, warnings []error, err error) {
+	tokens, err := tokenize(message, make([]token, 0, len(message)/4))
+	p := fastParser{message: message, tokens: tokens, lenient: true}
+	if err != nil {
+		p.warnings = append(p.warnings, err)
+	}
+
+	doc, err = p.document()
+	if err == nil && p.peek(0).typ != tokEOF {
+		p.warnings = append(p.warnings, p.unexpected())
+	}
+	return doc, p.warnings, err
+}
+
+func (p *fastParser) peek(n int) token {
+	if p.pos+n < len(p.tokens) {
+		return p.tokens[p.pos+n]
+	}
+	return token{typ: tokEOF, start: len(p.message), end: len(p.message)}
+}
+
+func (p *fastParser) text(t token) string {
+	return p.message[t.start:t.end]
+}
+
+// is reports whether the token n positions ahead is the punctuation or identifier s
+func (p *fastParser) is(n int, s string) bool {
+	t := p.peek(n)
+	return (t.typ == tokPunct || t.typ == tokIdent) && p.text(t) == s
+}
+
+func (p *fastParser) expect(s string) error {
+	if !p.is(0, s) {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *fastParser) unexpected() error {
+	t := p.peek(0)
+	if t.typ == tokEOF {
+		return &ParseError{Offset: t.start, Line: p.message, Err: errors.New("unexpected EOF")}
+	}
+	return &ParseError{Offset: t.start, Token: p.text(t), Line: p.message,
+		Err: fmt.Errorf("unexpected %v token", t.typ)}
+}
+
+// errorAt makes a ParseError at the token, unless err already is one
+func (p *fastParser) errorAt(t token, err error) error {
+	if _, ok := err.(*ParseError); ok || err == nil {
+		return err
+	}
+	return &ParseError{Offset: t.start, Token: p.text(t), Line: p.message, Err: err}
+}
+
+// startsKeyValue reports whether the next tokens look like the start of a key: value pair
+func (p *fastParser) startsKeyValue() bool {
+	switch t := p.peek(0); {
+	case t.typ == tokIdent:
+		return p.is(1, ":") || p.is(1, ".")
+	case p.is(0, "$"):
+		return p.peek(1).typ == tokIdent
+	}
+	return false
+}
+
+// document follows the PseudoJson grammar: either bare key-values intermixed with braced lists of
+// them, or a braced list followed by bare key-values.
+func (p *fastParser) document() (doc *PseudoJson, err error) {
+	doc = &PseudoJson{elems: make(ElementMap)}
+
+	if p.is(0, "{") {
+		p.pos++
+		if err = p.keyValueList(doc, "}"); err != nil {
+			return
+		}
+		for p.startsKeyValue() {
+			if err = p.keyValue(doc); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	if err = p.keyValue(doc); err != nil {
+		return
+	}
+	for {
+		if p.startsKeyValue() {
+			err = p.keyValue(doc)
+		} else if p.is(0, "{") && !p.is(1, "}") {
+			p.pos++
+			err = p.keyValueList(doc, "}")
+		} else {
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// keyValueList parses comma or space separated key-values up to and including the closing token
+func (p *fastParser) keyValueList(doc *PseudoJson, closing string) (err error) {
+	for !p.is(0, closing) {
+		if err = p.keyValue(doc); err != nil {
+			return
+		}
+		if p.is(0, ",") {
+			p.pos++
+			if !p.startsKeyValue() {
+				return p.unexpected()
+			}
+		}
+	}
+	p.pos++
+	return
+}
+
+func (p *fastParser) keyValue(doc *PseudoJson) (err error) {
+	start := p.peek(0)
+	if p.is(0, "$") {
+		p.pos++
+	}
+	if p.peek(0).typ != tokIdent {
+		return p.unexpected()
+	}
+	p.pos++
+	for p.is(0, ".") && p.peek(1).typ == tokIdent {
+		p.pos += 2
+	}
+	key := p.message[start.start:p.peek(-1).end]
+	if strings.ContainsAny(key, " \t\r\n") {
+		// Mongo doesn't log keys like that, but the grammar allows whitespace between the tokens
+		key = strings.Join(strings.Fields(key), "")
+	}
+	if err = p.expect(":"); err != nil {
+		return
+	}
+
+	elem := &keyValue{}
+	elem.kv.Key = key
+	elem.kv.Val = &elem.val
+	if err = p.value(&elem.val); err != nil {
+		return
+	}
+
+	doc.Elements = append(doc.Elements, &elem.kv)
+	doc.mapElement(key, &elem.val)
+	return
+}
+
+func (p *fastParser) value(v *Value) (err error) {
+	t := p.peek(0)
+	start := p.pos
+	defer func() {
+		err = p.errorAt(t, err)
+		if err != nil && p.lenient {
+			p.warnings = append(p.warnings, err)
+			p.pos = start
+			*v = Value{Kind: KindRaw, StringValue: p.skipValue()}
+			err = nil
+		}
+	}()
+
+	switch t.typ {
+	case tokString:
+		p.pos++
+		v.Kind = KindString
+		s := p.text(t)
+		if strings.IndexByte(s, '\\') < 0 && utf8.ValidString(s) {
+			v.StringValue = s[1 : len(s)-1]
+			return
+		}
+		v.StringValue, err = unquote(s)
+		return
+
+	case tokFloat, tokInt:
+		p.pos++
+		v.Kind = KindNumber
+		v.Double = t.typ == tokFloat
+		v.NumericValue, err = strconv.ParseFloat(p.text(t), 64)
+		return
+
+	case tokBinData:
+		p.pos++
+		v.Kind = KindBinData
+		v.BinDataValue = &BinDataValue{}
+		return v.BinDataValue.Capture([]string{p.text(t)})
+
+	case tokRegex:
+		p.pos++
+		v.Kind = KindRegex
+		v.RegexValue = &RegexValue{}
+		return v.RegexValue.Capture([]string{p.text(t)})
+
+	case tokIdent:
+		switch p.text(t) {
+		case "null":
+			p.pos++
+			v.Kind = KindNull
+			return
+		case "true", "false":
+			p.pos++
+			v.Kind = KindBool
+			v.BoolValue = p.text(t) == "true"
+			return
+		case "new":
+			if p.peek(1).typ == tokIdent && p.is(2, "(") {
+				p.pos++
+				return p.function(v)
+			}
+		}
+		if p.is(1, "(") {
+			return p.function(v)
+		}
+
+	case tokPunct:
+		switch p.text(t) {
+		case "-":
+			if n := p.peek(1); n.typ == tokFloat || n.typ == tokInt {
+				p.pos += 2
+				v.Kind = KindNumber
+				v.Double = n.typ == tokFloat
+				v.NumericValue, err = strconv.ParseFloat(p.text(n), 64)
+				v.NumericValue = -v.NumericValue
+				return
+			}
+		case "[":
+			p.pos++
+			v.Kind = KindArray
+			v.ArrayValue, err = p.valueList("]")
+			return
+		}
+	}
+
+	if p.is(0, "{") || p.startsKeyValue() {
+		v.Kind = KindDocument
+		v.Nested, err = p.document()
+		return
+	}
+	return p.unexpected()
+}
+
+// skipValue skips over the value up to the next separator at the same nesting level and returns
+// its text. The next key: value pair also ends the value, so that bare key-values are not lost,
+// and so does a closing bracket that doesn't match.
+func (p *fastParser) skipValue() string {
+	start := p.peek(0).start
+	end := start
+	var closers []string
+	for ; ; p.pos++ {
+		t := p.peek(0)
+		if t.typ == tokEOF {
+			break
+		}
+		if len(closers) == 0 && end > start && (p.is(0, ",") || p.startsKeyValue()) {
+			break
+		}
+		if t.typ == tokPunct {
+			switch text := p.text(t); text {
+			case "{":
+				closers = append(closers, "}")
+			case "[":
+				closers = append(closers, "]")
+			case "(":
+				closers = append(closers, ")")
+			case "}", "]", ")":
+				if len(closers) == 0 || closers[len(closers)-1] != text {
+					return p.message[start:end]
+				}
+				closers = closers[:len(closers)-1]
+			}
+		}
+		end = t.end
+	}
+	return p.message[start:end]
+}
+
+func (p *fastParser) function(v *Value) (err error) {
+	v.Kind = KindFunction
+	v.FuncValue = &FunctionValue{FuncName: p.text(p.peek(0))}
+	p.pos += 2
+	v.FuncValue.FuncArgs, err = p.valueList(")")
+	return
+}
+
+// valueList parses comma or space separated values up to and including the closing token
+func (p *fastParser) valueList(closing string) (values []*Value, err error) {
+	for !p.is(0, closing) {
+		if p.peek(0).typ == tokEOF {
+			return values, p.unexpected()
+		}
+		v := &Value{}
+		before := p.pos
+		if err = p.value(v); err != nil {
+			return
+		}
+		if p.pos == before {
+			// Lenient mode, and nothing that could be skipped as the value
+			return values, p.unexpected()
+		}
+		values = append(values, v)
+		if p.is(0, ",") {
+			p.pos++
+			if p.is(0, closing) {
+				return values, p.unexpected()
+			}
+		}
+	}
+	p.pos++
+	return
+}
@@ -0,0 +1,132 @@
+package mongolog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFastPseudoJsonParser(t *testing.T) {
+	testMessages := []string{
+		`{ kala: "maja", puu: 'juur', int: 1234, float: 12.34, neg: - 1, exp: 1e3, negexp: -2.5E-2 }`,
+		`{ find: "foocollection", projection: {}, foo: 2, empty: [], nulls: [ null, true, false ] }`,
+		`{ $kala: "maja", a.b.c: 1, $and: [ { x: 1 } { y: 2 }, { z: 3 } ], ünicode: "õun" }`,
+		`{ s: "with \"escapes\" and \\ and \u00e4", q: 'it\'s', empty: "", nl: "a
+b" }`,
+		`{ insert: "mycatpicscollection", ordered: true, $clusterTime: { clusterTime: Timestamp(1538979514, 76),` +
+			` signature: { hash: BinData(0, "A000000000000000000000000000000000000000"), keyId: 0 } },` +
+			` lsid: { id: UUID("c3cc9fef-182a-4917-9b5a-f715d0639ac2") }, $db: "FooDb" }`,
+		`{ a: BinData(0, E3B0C44298FC1C), b: BinData(4, 8c5f0e3b9a4a4f6e9d2b0c1e6f7a8b9c), c: BinData(0, ) }`,
+		`{ d: new Date(1538979514000), e: ISODate("2018-10-05T14:01:04.067Z"), f: MinKey(), g: f(1 2, 3) }`,
+		`{ name: /^foo.*/i, path: /a\/b/, filter: { $in: [ /^x/, /y$/m ] } }`,
+		`x: 1  y: 2 { z: 3 }`,
+		`x: 1 { y: 2, z: 3 } w: 4`,
+		`{ x: 1} y: 2 `,
+		`{ a: { b: 1 } c: 2 }`,
+		`{ a: b: 1 }`,
+		`{ x: 1, y: 2, x: 3, filter: { z: 1, z: 2 } }`,
+		`{ foo.FooObjectId: 1, foo.category: 1, foo.min_time: -1, foo.max_time: 1 }
+		   keysExamined:50314 docsExamined:2 cursorExhausted:1 numYields:393 nreturned:2 reslen:14980
+		   locks:{ Global: { acquireCount: { r: 788 } }, Database: { acquireCount: { r: 394 } },
+		   Collection: { acquireCount: { r: 394 } } }`,
+		benchmarkMessageLarge,
+	}
+
+	slow, _ := NewPseudoJsonParser()
+	fast, _ := NewFastPseudoJsonParser()
+	for _, v := range testMessages {
+		expect, err := ParsePseudoJson(slow, v)
+		if err != nil {
+			t.Errorf("unable to parse message: %v: %v", v, err)
+			continue
+		}
+		got, err := ParsePseudoJson(fast, v)
+		if err != nil {
+			t.Errorf("fast parser: unable to parse message: %v: %v", v, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, expect) {
+			gotJson, _ := got.ToExtendedJSON(false)
+			expectJson, _ := expect.ToExtendedJSON(false)
+			t.Errorf("fast parser mismatch: %v:\n%s\n%s", v, gotJson, expectJson)
+		}
+	}
+}
+
+func TestFastPseudoJsonParserErrors(t *testing.T) {
+	testMessages := []string{
+		``,
+		`{`,
+		`{ a: 1`,
+		`{ a: 1, }`,
+		`{ a: }`,
+		`{ a: [ 1, ] }`,
+		`{ a: f(1, ) }`,
+		`{ a: "unterminated }`,
+		`{ a: 1 } }`,
+		`{ 1: 2 }`,
+		`{ a: foo }`,
+		`{ a.: 1 }`,
+		`{ a: -x }`,
+		`{ a: 1e999 }`,
+	}
+
+	slow, _ := NewPseudoJsonParser()
+	fast, _ := NewFastPseudoJsonParser()
+	for _, v := range testMessages {
+		if _, err := ParsePseudoJson(slow, v); err == nil {
+			t.Errorf("expected an error from participle: %v", v)
+		}
+		if _, err := ParsePseudoJson(fast, v); err == nil {
+			t.Errorf("expected an error from the fast parser: %v", v)
+		}
+	}
+}
+
+func TestLenientPseudoJson(t *testing.T) {
+	testMessages := []struct {
+		message string
+		raw     map[string]string
+		ok      []string
+	}{
+		{
+			message: `{ a: 1, b: { c: %weird% }, d: "x" }`,
+			raw:     map[string]string{"b.c": "%weird%"},
+			ok:      []string{"a", "d"},
+		},
+		{
+			message: `{ a: [ 1, @, 3 ], b: foo, c: 2 }`,
+			raw:     map[string]string{"a.1": "@", "b": "foo"},
+			ok:      []string{"a.0", "a.2", "c"},
+		},
+		{
+			message: `{ a: Foo(1, ) bar: 2, q: { 1: 2 } }`,
+			raw:     map[string]string{"a": "Foo(1, )", "q": "{ 1: 2 }"},
+			ok:      []string{"bar"},
+		},
+		{
+			message: `{ a: f(1 } b: 1 }`,
+			raw:     map[string]string{"a": "f(1"},
+		},
+	}
+
+	for _, v := range testMessages {
+		doc, warnings, err := parseLenientPseudoJson(v.message)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", v.message, err)
+			continue
+		}
+		if len(warnings) == 0 {
+			t.Errorf("expected warnings: %v", v.message)
+		}
+		for path, raw := range v.raw {
+			if val := doc.Get(path); val == nil || val.Kind != KindRaw || val.StringValue != raw {
+				t.Errorf("%v: expected raw %q at %v, got %+v", v.message, raw, path, val)
+			}
+		}
+		for _, path := range v.ok {
+			if val := doc.Get(path); val == nil || val.Kind == KindRaw {
+				t.Errorf("%v: expected a value at %v, got %+v", v.message, path, val)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package mongolog
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// CommandHandler parses the command specific parts of a COMMAND log entry. The header and the
+// locks have already been filled in when it's called. The execution stats are parsed after it,
+// from where DefaultCommandHandler found the command parameters to end, so ExecStats is still nil.
+type CommandHandler func(parser *LogParser, entry *MongoLogEntry) error
+
+var (
+	commandHandlersLock sync.RWMutex
+	commandHandlers     = make(map[string]CommandHandler)
+)
+
+// RegisterCommandHandler sets the handler for the command, replacing the previous one if any.
+// Commands without a handler are parsed with DefaultCommandHandler.
+func RegisterCommandHandler(name string, h CommandHandler) {
+	commandHandlersLock.Lock()
+	defer commandHandlersLock.Unlock()
+	commandHandlers[name] = h
+}
+
+// LookupCommandHandler returns the handler registered for the command
+func LookupCommandHandler(name string) (h CommandHandler, ok bool) {
+	commandHandlersLock.RLock()
+	defer commandHandlersLock.RUnlock()
+	h, ok = commandHandlers[name]
+	return
+}
+
+// commandPayload finds the command parameters document of the COMMAND log message, and where it
+// is in the message. The plan summary and the execution stats follow it, from end on.
+func commandPayload(entry *MongoLogEntry) (params string, offset, end int, err *ParseError) {
+	loc := MongoLogCommandInfo.FindStringIndex(entry.LogMessage)
+	if loc == nil {
+		return "", 0, 0, newParseError(StageCommandInfo, entry, 0,
+			errors.New("COMMAND payload does not match expected"))
+	}
+
+	params, end, ok := extractEntryDocument(entry, loc[1])
+	if !ok {
+		return "", loc[1], end, newParseError(StageCommandParams, entry, loc[1],
+			errors.New("document not found"))
+	}
+	entry.statsOffset = end
+	return params, loc[1], end, nil
+}
+
+// DefaultCommandHandler parses the command parameters and the plan summary if there is one. It is
+// used for the commands without a registered handler, and the registered handlers can call it to
+// parse the parts that are common to all the commands.
+func DefaultCommandHandler(parser *LogParser, entry *MongoLogEntry) (err error) {
+	params, offset, end, perr := commandPayload(entry)
+	if perr != nil {
+		return parser.tolerate(entry, perr)
+	}
+
+	entry.CommandParameters, err = parser.parseDocument(parser.commandParametersParser,
+		StageCommandParams, entry, offset, params)
+	if err != nil {
+		return
+	}
+
+	// Not all of them have a plan, ie. aggregate with just $indexStats
+	if plan := strings.Index(entry.LogMessage[end:], " planSummary: "); plan >= 0 {
+		plan += end + len(" planSummary: ")
+		entry.PlanInfo, err = ParsePlanSummary(parser.planSummaryParser, entry.LogMessage[plan:])
+		if err != nil {
+			entry.PlanInfo = nil
+			return parser.tolerate(entry, newParseError(StagePlanSummary, entry, plan, err))
+		}
+	}
+
+	return
+}
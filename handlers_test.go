@@ -0,0 +1,100 @@
+package mongolog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGenericCommandHandler(t *testing.T) {
+	testMessages := map[string]string{
+		"distinct": `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.mycatpicscollection` +
+			` command: distinct { distinct: "mycatpicscollection", key: "category", query: { a: 1 } }` +
+			` planSummary: IXSCAN { a: 1 } keysExamined:5 docsExamined:5 numYields:0 reslen:100` +
+			` locks:{ Global: { acquireCount: { r: 2 } } } protocol:op_msg 150ms`,
+		"aggregate": `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.mycatpicscollection` +
+			` command: aggregate { aggregate: "mycatpicscollection", pipeline: [ { $indexStats: {} } ],` +
+			` cursor: {} } keysExamined:0 docsExamined:0 cursorExhausted:1 numYields:0 nreturned:2` +
+			` reslen:540 locks:{ Global: { acquireCount: { r: 4 } } } protocol:op_query 18ms`,
+		"createIndexes": `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.$cmd` +
+			` command: createIndexes { createIndexes: "mycatpicscollection", indexes: [ { key: { a: 1 },` +
+			` name: "a_1" } ] } numYields:0 reslen:100 locks:{} protocol:op_msg 1200ms`,
+		"insert": `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.mycatpicscollection` +
+			` command: insert { insert: "mycatpicscollection", ordered: true, $clusterTime:` +
+			` { clusterTime: Timestamp(1538979514, 76), signature: {` +
+			` hash: BinData(0, 0000000000000000000000000000000000000000), keyId: 0 } },` +
+			` lsid: { id: UUID("c3cc9fef-182a-4917-9b5a-f715d0639ac2") }, $db: "FooDb" }` +
+			` ninserted:1 keysInserted:3 numYields:0 reslen:229 locks:{ Global: ` +
+			`{ acquireCount: { r: 2, w: 2 } }, Database: { acquireCount: { w: 2 },` +
+			` acquireWaitCount: { w: 1 }, timeAcquiringMicros: { w: 12259 } },` +
+			` Collection: { acquireCount: { w: 1 } }, oplog: { acquireCount: { w: 1 } } }` +
+			` protocol:op_query 12ms`,
+		"brandNewCommand": `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.$cmd` +
+			` command: brandNewCommand { brandNewCommand: 1, foo: "bar" } numYields:0 reslen:100` +
+			` protocol:op_msg 120ms`,
+	}
+
+	parser, _ := NewLogParser()
+	for command, logLine := range testMessages {
+		m, err := ParseLogEntry(parser, logLine)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", command, err)
+			continue
+		}
+		if m.Command != command {
+			t.Errorf("expected command %v, got %v", command, m.Command)
+		}
+		// The stats must not end up in the command parameters
+		if keys := m.CommandParameters.Keys(); len(keys) == 0 || keys[0] != command || m.CommandParameters.Has("numYields") {
+			t.Errorf("%v: unexpected command parameters: %v", command, keys)
+		}
+		if m.ExecStats == nil {
+			t.Errorf("%v: expected exec stats", command)
+		}
+	}
+}
+
+func TestRegisterCommandHandler(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.$cmd` +
+		` command: myCustomCommand { myCustomCommand: 1 } numYields:0 reslen:100 protocol:op_msg 120ms`
+
+	RegisterCommandHandler("myCustomCommand", func(parser *LogParser, entry *MongoLogEntry) error {
+		return fmt.Errorf("custom handler called")
+	})
+
+	parser, _ := NewLogParser()
+	if _, err := ParseLogEntry(parser, logLine); err == nil || err.Error() != "custom handler called" {
+		t.Errorf("expected the custom handler to be called, got %v", err)
+	}
+
+	if _, ok := LookupCommandHandler("find"); ok {
+		t.Errorf("expected no handler for find")
+	}
+}
+
+func TestDelegateToDefaultCommandHandler(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.$cmd` +
+		` command: myOtherCommand { myOtherCommand: "foo", level: 2 } numYields:0 reslen:100` +
+		` protocol:op_msg 120ms`
+
+	RegisterCommandHandler("myOtherCommand", func(parser *LogParser, entry *MongoLogEntry) error {
+		if err := DefaultCommandHandler(parser, entry); err != nil {
+			return err
+		}
+		entry.Namespace, _ = entry.CommandParameters.GetString("myOtherCommand")
+		return nil
+	})
+
+	parser, _ := NewLogParser()
+	m, err := ParseLogEntry(parser, logLine)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if n, ok := m.CommandParameters.GetNumber("level"); !ok || n != 2 || m.Namespace != "foo" {
+		t.Errorf("unexpected entry: %v %+v", m.Namespace, m.CommandParameters)
+	}
+	if m.ExecStats == nil || m.ExecStats.Duration != 120*time.Millisecond {
+		t.Errorf("unexpected exec stats: %+v", m.ExecStats)
+	}
+}
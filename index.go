@@ -0,0 +1,263 @@
+package mongolog
+
+import (
+	"sort"
+	"strings"
+)
+
+// The query operators that make the field a range in the equality-sort-range rule
+var rangeOperators = map[string]bool{
+	"$gt": true, "$gte": true, "$lt": true, "$lte": true, "$ne": true, "$nin": true,
+	"$regex": true, "$exists": true, "$type": true, "$elemMatch": true, "$not": true,
+}
+
+// IndexSuggestion is a candidate index for the collection scanning queries of a namespace
+type IndexSuggestion struct {
+	Namespace string
+	Keys      []*IndexKey
+	// Count is the number of collection scanning queries that the index would serve
+	Count int
+	// Shapes are the query shapes of these queries
+	Shapes []*QueryShape
+	// Redundant are the observed indexes of the namespace that are a prefix of this index, and
+	// so could be dropped once it's created
+	Redundant [][]*IndexKey
+}
+
+func (s *IndexSuggestion) String() string {
+	return s.Namespace + " " + FormatKeyPattern(s.Keys)
+}
+
+// IndexAdvisor proposes indexes for the queries that were logged with a COLLSCAN plan. The index
+// keys follow the equality-sort-range rule: the fields compared for equality come first, then the
+// sort fields and then the fields queried by a range. It is not safe for concurrent use.
+type IndexAdvisor struct {
+	// The index suggestions by namespace and key pattern
+	candidates map[string]map[string]*IndexSuggestion
+	// The index key patterns seen in the plans, by namespace and key pattern
+	observed map[string]map[string][]*IndexKey
+}
+
+func NewIndexAdvisor() *IndexAdvisor {
+	return &IndexAdvisor{
+		candidates: make(map[string]map[string]*IndexSuggestion),
+		observed:   make(map[string]map[string][]*IndexKey),
+	}
+}
+
+// Add records the indexes used by the entry and, if it scanned the collection, the index that
+// would have served it. Returns true if an index was suggested for the entry.
+func (advisor *IndexAdvisor) Add(entry *MongoLogEntry) bool {
+	if entry.PlanInfo == nil || entry.CommandParameters == nil {
+		return false
+	}
+
+	for _, item := range entry.PlanInfo.Items {
+		if len(item.KeyPattern) > 0 {
+			if advisor.observed[entry.Namespace] == nil {
+				advisor.observed[entry.Namespace] = make(map[string][]*IndexKey)
+			}
+			advisor.observed[entry.Namespace][FormatKeyPattern(item.KeyPattern)] = item.KeyPattern
+		}
+	}
+
+	if !entry.PlanInfo.HasStage("COLLSCAN") {
+		return false
+	}
+	filter, sortSpec, _ := queryDocuments(entry.Command, entry.CommandParameters)
+	keys := suggestIndexKeys(filter, sortSpec)
+	if len(keys) == 0 {
+		return false
+	}
+
+	pattern := FormatKeyPattern(keys)
+	if advisor.candidates[entry.Namespace] == nil {
+		advisor.candidates[entry.Namespace] = make(map[string]*IndexSuggestion)
+	}
+	suggestion, ok := advisor.candidates[entry.Namespace][pattern]
+	if !ok {
+		suggestion = &IndexSuggestion{Namespace: entry.Namespace, Keys: keys}
+		advisor.candidates[entry.Namespace][pattern] = suggestion
+	}
+	suggestion.Count++
+	if shape := NewQueryShape(entry); shape != nil && !hasShape(suggestion.Shapes, shape) {
+		suggestion.Shapes = append(suggestion.Shapes, shape)
+	}
+	return true
+}
+
+// Suggestions returns the suggested indexes, the ones serving the most queries first. The
+// candidates that are a prefix of another candidate of the namespace are merged into it, as the
+// longer index serves both.
+func (advisor *IndexAdvisor) Suggestions() []*IndexSuggestion {
+	var result []*IndexSuggestion
+	for namespace, candidates := range advisor.candidates {
+		merged := mergeIndexSuggestions(candidates)
+		for _, s := range merged {
+			s.Redundant = nil
+			for _, observed := range advisor.observed[namespace] {
+				if len(observed) < len(s.Keys) && isKeyPrefix(observed, s.Keys) {
+					s.Redundant = append(s.Redundant, observed)
+				}
+			}
+			sort.Slice(s.Redundant, func(i, j int) bool {
+				return FormatKeyPattern(s.Redundant[i]) < FormatKeyPattern(s.Redundant[j])
+			})
+		}
+		result = append(result, merged...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+// mergeIndexSuggestions merges the candidates into the longest candidate that they are a prefix
+// of. The merged suggestions are copies, the candidates are not modified.
+func mergeIndexSuggestions(candidates map[string]*IndexSuggestion) []*IndexSuggestion {
+	sorted := make([]*IndexSuggestion, 0, len(candidates))
+	for _, c := range candidates {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].Keys) != len(sorted[j].Keys) {
+			return len(sorted[i].Keys) > len(sorted[j].Keys)
+		}
+		return FormatKeyPattern(sorted[i].Keys) < FormatKeyPattern(sorted[j].Keys)
+	})
+
+	var merged []*IndexSuggestion
+next:
+	for _, c := range sorted {
+		for _, m := range merged {
+			if isKeyPrefix(c.Keys, m.Keys) {
+				m.Count += c.Count
+				for _, shape := range c.Shapes {
+					if !hasShape(m.Shapes, shape) {
+						m.Shapes = append(m.Shapes, shape)
+					}
+				}
+				continue next
+			}
+		}
+		copied := *c
+		copied.Shapes = append([]*QueryShape(nil), c.Shapes...)
+		merged = append(merged, &copied)
+	}
+	return merged
+}
+
+// suggestIndexKeys builds the index keys for the filter and sort by the equality-sort-range rule.
+// The equality and range fields are sorted by name, their order doesn't matter for the query.
+func suggestIndexKeys(filter, sortSpec *PseudoJson) (keys []*IndexKey) {
+	var equality, ranges []string
+	seen := make(map[string]bool)
+	collectFilterFields(filter, &equality, &ranges)
+	sort.Strings(equality)
+	sort.Strings(ranges)
+
+	add := func(field string, direction int) {
+		if !seen[field] {
+			seen[field] = true
+			keys = append(keys, &IndexKey{Field: field, Direction: direction})
+		}
+	}
+
+	for _, field := range equality {
+		add(field, 1)
+	}
+	sortSpec.Range(func(field string, v *Value) bool {
+		if v.Kind != KindNumber {
+			// ie. { score: { $meta: "textScore" } }, the rest of the sort can't use the index
+			return false
+		}
+		if v.NumericValue < 0 {
+			add(field, -1)
+		} else {
+			add(field, 1)
+		}
+		return true
+	})
+	for _, field := range ranges {
+		add(field, 1)
+	}
+	return
+}
+
+// collectFilterFields sorts the filter fields into the equality and range fields. The $and
+// clauses are merged into the filter, the other top level operators such as $or, $text and
+// $expr can't be served by a single regular index and are left out.
+func collectFilterFields(filter *PseudoJson, equality, ranges *[]string) {
+	filter.Range(func(field string, v *Value) bool {
+		if field == "$and" && v.Kind == KindArray {
+			for _, clause := range v.ArrayValue {
+				if clause.Kind == KindDocument {
+					collectFilterFields(clause.Nested, equality, ranges)
+				}
+			}
+			return true
+		}
+		if strings.HasPrefix(field, "$") {
+			return true
+		}
+
+		if isRangeCondition(v) {
+			*ranges = append(*ranges, field)
+		} else {
+			*equality = append(*equality, field)
+		}
+		return true
+	})
+}
+
+// isRangeCondition reports whether the value of the filter field is a range condition rather
+// than an equality. $eq and $in are equality, as are the plain values other than regexes.
+func isRangeCondition(v *Value) bool {
+	switch v.Kind {
+	case KindRegex:
+		return true
+	case KindDocument:
+		isRange := false
+		v.Nested.Range(func(op string, _ *Value) bool {
+			isRange = rangeOperators[op]
+			return !isRange
+		})
+		return isRange
+	}
+	return false
+}
+
+// isKeyPrefix reports whether the key pattern is a prefix of the other, directions included
+func isKeyPrefix(prefix, keys []*IndexKey) bool {
+	if len(prefix) > len(keys) {
+		return false
+	}
+	for i, k := range prefix {
+		if k.Field != keys[i].Field || k.Direction != keys[i].Direction || k.Type != keys[i].Type {
+			return false
+		}
+	}
+	return true
+}
+
+func hasShape(shapes []*QueryShape, shape *QueryShape) bool {
+	for _, s := range shapes {
+		if s.String() == shape.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatKeyPattern formats the index key pattern the way Mongo logs it, ie. { a: 1, b: -1 }
+func FormatKeyPattern(keys []*IndexKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k.String())
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
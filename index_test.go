@@ -0,0 +1,107 @@
+package mongolog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSuggestIndexKeys(t *testing.T) {
+	testQueries := []struct {
+		filter string
+		sort   string
+		expect string
+	}{
+		{`{ a: 1 }`, `{}`, `{ a: 1 }`},
+		{`{ b: "x", a: 1 }`, `{}`, `{ a: 1, b: 1 }`},
+		{`{ c: { $gt: 5 }, a: 1 }`, `{ b: -1 }`, `{ a: 1, b: -1, c: 1 }`},
+		{`{ a: { $in: [ 1, 2 ] }, b: /^foo/ }`, `{}`, `{ a: 1, b: 1 }`},
+		{`{ b: /^foo/, a: { $eq: 1 } }`, `{ a: 1 }`, `{ a: 1, b: 1 }`},
+		{`{ $and: [ { a: 1 }, { b: { $lt: 2 } } ], c: 1 }`, `{}`, `{ a: 1, c: 1, b: 1 }`},
+		{`{ $or: [ { a: 1 }, { b: 1 } ] }`, `{ c: 1, d: { $meta: "textScore" }, e: 1 }`, `{ c: 1 }`},
+		{`{ x.y: { $exists: true } }`, `{}`, `{ x.y: 1 }`},
+		{`{ $text: { $search: "foo" } }`, `{}`, ``},
+	}
+
+	parser, _ := NewPseudoJsonParser()
+	for _, v := range testQueries {
+		filter, err := ParseCommandParameters(parser, v.filter)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", v.filter, err)
+		}
+		sortSpec, err := ParseCommandParameters(parser, v.sort)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", v.sort, err)
+		}
+
+		keys := suggestIndexKeys(filter, sortSpec)
+		result := ""
+		if len(keys) > 0 {
+			result = FormatKeyPattern(keys)
+		}
+		if result != v.expect {
+			t.Errorf("%v %v: expected %v, got %v", v.filter, v.sort, v.expect, result)
+		}
+	}
+}
+
+func TestIndexAdvisor(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.%v command: find` +
+		` { find: "%v", filter: %v, sort: %v } planSummary: %v keysExamined:0 docsExamined:100` +
+		` numYields:0 nreturned:1 reslen:100 protocol:op_msg 150ms`
+
+	advisor := NewIndexAdvisor()
+	parser, _ := NewLogParser()
+	add := func(collection, filter, sort, plan string) bool {
+		m, err := parser.Parse(fmt.Sprintf(logLine, collection, collection, filter, sort, plan))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return advisor.Add(&m)
+	}
+
+	if add("cats", `{ a: 1 }`, `{}`, `IXSCAN { a: 1 }`) {
+		t.Errorf("no suggestion expected for an index scan")
+	}
+	add("cats", `{ a: 1, b: { $gt: 1 } }`, `{ c: 1 }`, `COLLSCAN`)
+	add("cats", `{ a: 2, b: { $gt: 2 } }`, `{ c: 1 }`, `COLLSCAN`)
+	add("cats", `{ a: 1 }`, `{ c: 1 }`, `COLLSCAN`)
+	add("cats", `{ d: 1 }`, `{}`, `COLLSCAN`)
+	add("dogs", `{ a: 1 }`, `{}`, `COLLSCAN`)
+	if add("dogs", `{ $text: { $search: "x" } }`, `{}`, `COLLSCAN`) {
+		t.Errorf("no suggestion expected for a text search")
+	}
+	legacy := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] getmore FooDb.birds` +
+		` query: { b: 5, a: { $gt: 2 } } planSummary: COLLSCAN cursorid:12345 ntoreturn:0 keysExamined:0` +
+		` docsExamined:200 numYields:1 nreturned:101 reslen:4000 15ms`
+	if m, err := parser.Parse(legacy); err != nil || !advisor.Add(&m) {
+		t.Errorf("expected a suggestion for the legacy getmore: %v", err)
+	}
+
+	suggestions := advisor.Suggestions()
+	expect := []struct {
+		suggestion string
+		count      int
+		shapes     int
+		redundant  string
+	}{
+		{"FooDb.cats { a: 1, c: 1, b: 1 }", 3, 2, "[{ a: 1 }]"},
+		{"FooDb.birds { b: 1, a: 1 }", 1, 1, "[]"},
+		{"FooDb.cats { d: 1 }", 1, 1, "[]"},
+		{"FooDb.dogs { a: 1 }", 1, 1, "[]"},
+	}
+	if len(suggestions) != len(expect) {
+		t.Fatalf("expected %v suggestions, got %v", len(expect), suggestions)
+	}
+	for i, v := range expect {
+		s := suggestions[i]
+		redundant := []string{}
+		for _, keys := range s.Redundant {
+			redundant = append(redundant, FormatKeyPattern(keys))
+		}
+		if s.String() != v.suggestion || s.Count != v.count || len(s.Shapes) != v.shapes ||
+			fmt.Sprint(redundant) != v.redundant {
+			t.Errorf("expected %v (%v, %v, %v), got %v (%v, %v, %v)", v.suggestion, v.count, v.shapes,
+				v.redundant, s, s.Count, len(s.Shapes), redundant)
+		}
+	}
+}
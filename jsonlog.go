@@ -0,0 +1,367 @@
+package mongolog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MongoDb 4.4+ structured log message ids that we care about
+const (
+	jsonLogConnectionAccepted = 22943
+	jsonLogConnectionEnded    = 22944
+	jsonLogClientMetadata     = 51800
+)
+
+type jsonLogLine struct {
+	T struct {
+		Date string `json:"$date"`
+	} `json:"t"`
+	S    string          `json:"s"`
+	C    string          `json:"c"`
+	ID   int             `json:"id"`
+	Ctx  string          `json:"ctx"`
+	Msg  string          `json:"msg"`
+	Attr json.RawMessage `json:"attr"`
+}
+
+type jsonLogAttr struct {
+	Namespace      string          `json:"ns"`
+	Remote         string          `json:"remote"`
+	ConnectionId   int64           `json:"connectionId"`
+	Doc            json.RawMessage `json:"doc"`
+	Command        json.RawMessage `json:"command"`
+	PlanSummary    string          `json:"planSummary"`
+	DurationMillis *int64          `json:"durationMillis"`
+	Locks          json.RawMessage `json:"locks"`
+
+	KeysExamined    int64  `json:"keysExamined"`
+	DocsExamined    int64  `json:"docsExamined"`
+	NReturned       int64  `json:"nreturned"`
+	NumYields       int64  `json:"numYields"`
+	ResLen          int64  `json:"reslen"`
+	CursorExhausted bool   `json:"cursorExhausted"`
+	HasSortStage    bool   `json:"hasSortStage"`
+	WriteConflicts  int64  `json:"writeConflicts"`
+	NMatched        int64  `json:"nMatched"`
+	NModified       int64  `json:"nModified"`
+	NInserted       int64  `json:"ninserted"`
+	NDeleted        int64  `json:"ndeleted"`
+	Protocol        string `json:"protocol"`
+}
+
+func (attr *jsonLogAttr) execStats() *ExecStats {
+	if attr.DurationMillis == nil {
+		return nil
+	}
+	return &ExecStats{
+		KeysExamined:    attr.KeysExamined,
+		DocsExamined:    attr.DocsExamined,
+		NReturned:       attr.NReturned,
+		NumYields:       attr.NumYields,
+		ResLen:          attr.ResLen,
+		CursorExhausted: attr.CursorExhausted,
+		HasSortStage:    attr.HasSortStage,
+		WriteConflicts:  attr.WriteConflicts,
+		NMatched:        attr.NMatched,
+		NModified:       attr.NModified,
+		NInserted:       attr.NInserted,
+		NDeleted:        attr.NDeleted,
+		Duration:        time.Duration(*attr.DurationMillis) * time.Millisecond,
+		Protocol:        attr.Protocol,
+	}
+}
+
+func isJsonLogLine(logLine string) bool {
+	return strings.HasPrefix(strings.TrimSpace(logLine), "{")
+}
+
+// parseJsonLogHeader parses the header of the MongoDb 4.4+ structured log line, it is the JSON
+// log counterpart of LogParser.parseHeader
+func parseJsonLogHeader(parser *LogParser, logLine string) (result MongoLogEntry, body bodyParser, err error) {
+	result.messageOffset = -1
+
+	var line jsonLogLine
+	if err = json.Unmarshal([]byte(logLine), &line); err != nil {
+		perr := &ParseError{Stage: StageHeader, Offset: -1, Err: err}
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			perr.Offset = int(syntaxErr.Offset)
+		}
+		return result, nil, perr
+	}
+	result.Timestamp = line.T.Date
+	// The entry is kept with a zero Time if the timestamp is not understood, in the strict mode too
+	result.Time, err = ParseTimestamp(result.Timestamp, parser.year, parser.location)
+	if err != nil {
+		result.Warnings = append(result.Warnings, &ParseError{Stage: StageHeader, Offset: -1,
+			Token: result.Timestamp, Err: err})
+		err = nil
+	}
+	result.Severity = Severity(line.S)
+	result.Component = Component(strings.TrimSpace(line.C))
+	// Keep the context in the same form as the text logs, connection tracking is keyed by it
+	result.Context = "[" + line.Ctx + "]"
+	result.LogMessage = line.Msg
+
+	var attr jsonLogAttr
+	if len(line.Attr) > 0 {
+		if err = json.Unmarshal(line.Attr, &attr); err != nil {
+			return result, nil, newParseError(StageHeader, &result, 0, err)
+		}
+	}
+
+	switch line.ID {
+	case jsonLogConnectionAccepted:
+		ip, port, _ := net.SplitHostPort(attr.Remote)
+		handleNewConnection(parser, &result, map[string]string{
+			"ip":   ip,
+			"port": port,
+			"id":   strconv.FormatInt(attr.ConnectionId, 10),
+		})
+	case jsonLogConnectionEnded:
+		ip, port, _ := net.SplitHostPort(attr.Remote)
+		handleCloseConnection(parser, &result, map[string]string{"ip": ip, "port": port})
+	case jsonLogClientMetadata:
+		// The entry is kept without the metadata, in the strict mode too
+		if connMeta, err := jsonToPseudoJson(attr.Doc); err != nil {
+			result.Warnings = append(result.Warnings, newParseError(StageConnection, &result, 0, err))
+		} else {
+			handleConnectionMetadata(parser, &result, connMeta)
+		}
+	}
+
+	if conn, ok := parser.connections.Lookup(result.Context); ok {
+		result.ConnectionInfo = conn
+	}
+
+	if result.Component == ComponentCommand || result.Component == ComponentWrite || len(attr.Command) > 0 {
+		body = func(result *MongoLogEntry) error {
+			return parseJsonLogBody(parser, result, &attr)
+		}
+	}
+	return
+}
+
+// parseJsonLogBody converts the command, locks and plan summary of the JSON log entry
+func parseJsonLogBody(parser *LogParser, result *MongoLogEntry, attr *jsonLogAttr) (err error) {
+	if result.Component == ComponentCommand || result.Component == ComponentWrite {
+		result.ExecStats = attr.execStats()
+
+		if len(attr.Locks) > 0 {
+			locks, err := jsonToPseudoJson(attr.Locks)
+			if err == nil {
+				result.Locks, err = lockStatsFromDocument(locks)
+			}
+			// The entry is kept without the lock stats, in the strict mode too
+			if err != nil {
+				result.Locks = nil
+				result.Warnings = append(result.Warnings, newParseError(StageLocks, result, 0, err))
+			}
+		}
+	}
+
+	if len(attr.Command) == 0 {
+		return nil
+	}
+
+	result.Namespace = attr.Namespace
+	result.CommandParameters, err = jsonToPseudoJson(attr.Command)
+	if err != nil {
+		result.CommandParameters = nil
+		if err = parser.tolerate(result, newParseError(StageCommandParams, result, 0, err)); err != nil {
+			return
+		}
+	}
+	if keys := result.CommandParameters.Keys(); len(keys) > 0 {
+		result.Command = keys[0]
+	}
+
+	if attr.PlanSummary != "" {
+		result.PlanInfo, err = ParsePlanSummary(parser.planSummaryParser, attr.PlanSummary)
+		if err != nil {
+			result.PlanInfo = nil
+			return parser.tolerate(result, newParseError(StagePlanSummary, result, 0, err))
+		}
+	}
+
+	return
+}
+
+// jsonToPseudoJson converts relaxed Extended JSON into the same PseudoJson structure that the
+// text logs parse into. Eg. {"$oid": "..."} becomes ObjectId("...").
+func jsonToPseudoJson(data []byte) (*PseudoJson, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	v, err := decodeJsonValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if v.Kind != KindDocument {
+		return nil, fmt.Errorf("expecting a JSON object, got %v", v.Kind)
+	}
+	return v.Nested, nil
+}
+
+func decodeJsonValue(decoder *json.Decoder) (*Value, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case nil:
+		return &Value{Kind: KindNull}, nil
+	case string:
+		return &Value{Kind: KindString, StringValue: t}, nil
+	case bool:
+		return &Value{Kind: KindBool, BoolValue: t}, nil
+	case json.Number:
+		n, err := t.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Kind: KindNumber, NumericValue: n, Double: strings.ContainsAny(string(t), ".eE")}, nil
+	case json.Delim:
+		switch t {
+		case '[':
+			v := &Value{Kind: KindArray}
+			for decoder.More() {
+				elem, err := decodeJsonValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				v.ArrayValue = append(v.ArrayValue, elem)
+			}
+			_, err = decoder.Token()
+			return v, err
+		case '{':
+			doc := &PseudoJson{elems: make(ElementMap)}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				elem, err := decodeJsonValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				doc.Elements = append(doc.Elements, &KeyValue{Key: key.(string), Val: elem})
+				doc.mapElement(key.(string), elem)
+			}
+			if _, err = decoder.Token(); err != nil {
+				return nil, err
+			}
+			return fromExtendedJson(doc)
+		}
+	}
+	return nil, fmt.Errorf("unexpected JSON token: %v", token)
+}
+
+func funcValue(name string, args ...*Value) *Value {
+	return &Value{Kind: KindFunction, FuncValue: &FunctionValue{FuncName: name, FuncArgs: args}}
+}
+
+func stringValue(s string) *Value {
+	return &Value{Kind: KindString, StringValue: s}
+}
+
+func numberValue(n float64) *Value {
+	return &Value{Kind: KindNumber, NumericValue: n}
+}
+
+// fromExtendedJson turns the Extended JSON type wrappers into the values that text logs would have
+func fromExtendedJson(doc *PseudoJson) (*Value, error) {
+	plain := &Value{Kind: KindDocument, Nested: doc}
+	if len(doc.Elements) == 0 || !strings.HasPrefix(doc.Elements[0].Key, "$") {
+		return plain, nil
+	}
+
+	first := doc.Elements[0].Val
+	switch doc.Elements[0].Key {
+	case "$oid":
+		return funcValue("ObjectId", first), nil
+
+	case "$date":
+		if first.Kind == KindString {
+			t, err := time.Parse(time.RFC3339Nano, first.StringValue)
+			if err != nil {
+				return nil, fmt.Errorf("$date: %v", err)
+			}
+			return funcValue("Date", numberValue(float64(t.UnixNano()/int64(time.Millisecond)))), nil
+		}
+		// The canonical { $numberLong: "..." } has already been converted into a number
+		return funcValue("Date", first), nil
+
+	case "$numberInt", "$numberLong", "$numberDouble":
+		n, err := strconv.ParseFloat(first.StringValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", doc.Elements[0].Key, err)
+		}
+		v := numberValue(n)
+		v.Double = doc.Elements[0].Key == "$numberDouble"
+		return v, nil
+
+	case "$numberDecimal":
+		return funcValue("NumberDecimal", first), nil
+
+	case "$timestamp":
+		seconds, increment := first.Get("t"), first.Get("i")
+		if seconds == nil || increment == nil {
+			return nil, fmt.Errorf("$timestamp: expecting t and i")
+		}
+		return funcValue("Timestamp", seconds, increment), nil
+
+	case "$uuid":
+		return funcValue("UUID", first), nil
+
+	case "$binary":
+		var payload, subtype string
+		if first.Kind == KindDocument {
+			payload, _ = first.Nested.GetString("base64")
+			subtype, _ = first.Nested.GetString("subType")
+		} else {
+			// Legacy form: { "$binary": "...", "$type": "00" }
+			payload = first.StringValue
+			subtype, _ = doc.GetString("$type")
+		}
+		return binaryValue(payload, subtype)
+
+	case "$regularExpression":
+		pattern, _ := first.Nested.GetString("pattern")
+		options, _ := first.Nested.GetString("options")
+		return &Value{Kind: KindRegex, RegexValue: &RegexValue{Pattern: pattern, Flags: options}}, nil
+
+	case "$minKey":
+		return funcValue("MinKey"), nil
+	case "$maxKey":
+		return funcValue("MaxKey"), nil
+	}
+
+	// Query operators such as $gte are plain documents
+	return plain, nil
+}
+
+func binaryValue(payload, subtype string) (*Value, error) {
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("$binary: %v", err)
+	}
+	t, err := strconv.ParseUint(subtype, 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("$binary: invalid subType %q", subtype)
+	}
+
+	// Text logs print the standard UUIDs as UUID("...")
+	if t == 4 && len(data) == 16 {
+		h := hex.EncodeToString(data)
+		return funcValue("UUID", stringValue(h[0:8]+"-"+h[8:12]+"-"+h[12:16]+"-"+h[16:20]+"-"+h[20:])), nil
+	}
+	return &Value{Kind: KindBinData, BinDataValue: &BinDataValue{Subtype: byte(t), Data: data}}, nil
+}
@@ -0,0 +1,181 @@
+package mongolog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJsonLogEntry(t *testing.T) {
+	newConnectionMessage := `{"t":{"$date":"2020-08-11T09:13:46.617+00:00"},"s":"I",  "c":"NETWORK",  "id":22943,` +
+		`   "ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.178.5.250:47878",` +
+		`"connectionId":12,"connectionCount":1}}`
+	slowQueryMessage := `{"t":{"$date":"2020-08-11T09:13:47.011+00:00"},"s":"I",  "c":"COMMAND",  "id":51803,` +
+		`   "ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"FooDb.mycatpicscollection",` +
+		`"command":{"find":"mycatpicscollection","filter":{"foo.FooObjectId":{"$oid":"5a8c3a142053a407a936745e"},` +
+		`"foo.max_time":{"$gte":1534769530.5},"foo.when":{"$date":"2018-10-08T06:01:01Z"},` +
+		`"foo.category":{"$in":["alley","home"]}},"lsid":{"id":{"$uuid":"c3cc9fef-182a-4917-9b5a-f715d0639ac2"}},` +
+		`"$db":"FooDb"},"planSummary":"IXSCAN { foo.FooObjectId: 1, foo.category: 1 }","keysExamined":50314,` +
+		`"docsExamined":2,"cursorExhausted":true,"numYields":393,"nreturned":2,"reslen":14980,` +
+		`"locks":{"Global":{"acquireCount":{"r":788}}},"protocol":"op_msg","durationMillis":219}}`
+	clientMetadataMessage := `{"t":{"$date":"2020-08-11T09:13:46.618+00:00"},"s":"I",  "c":"NETWORK",  "id":51800,` +
+		`   "ctx":"conn12","msg":"client metadata","attr":{"remote":"10.178.5.250:47878","client":"conn12",` +
+		`"doc":{"driver":{"name":"PyMongo","version":"3.11.0"},"os":{"type":"Linux"},` +
+		`"platform":"CPython 3.8.5.final.0","application":{"name":"catpics-api"}}}}`
+	endConnectionMessage := `{"t":{"$date":"2020-08-11T09:13:48.000+00:00"},"s":"I",  "c":"NETWORK",  "id":22944,` +
+		`   "ctx":"conn12","msg":"Connection ended","attr":{"remote":"10.178.5.250:47878","connectionId":12,` +
+		`"connectionCount":0}}`
+
+	parser, err := NewLogParser()
+	if err != nil {
+		t.Errorf("Failed to initialize parser: %v\n", err)
+		return
+	}
+
+	m, err := ParseLogEntry(parser, newConnectionMessage)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if m.ConnectionInfo == nil || m.ConnectionInfo.ConnectionId != "[conn12]" ||
+		m.ConnectionInfo.IpAddress != "10.178.5.250" || m.ConnectionInfo.Port != "47878" {
+		t.Errorf("unexpected connection info: %+v", m.ConnectionInfo)
+	}
+
+	if _, err = ParseLogEntry(parser, clientMetadataMessage); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+
+	m, err = ParseLogEntry(parser, slowQueryMessage)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+
+	expectValues := map[string]string{
+		"timestamp": "2020-08-11T09:13:47.011+00:00",
+		"severity":  "I",
+		"component": "COMMAND",
+		"context":   "[conn12]",
+		"message":   "Slow query",
+	}
+	checkExpectedValues(t, expectValues, map[string]string{
+		"timestamp": m.Timestamp,
+		"severity":  string(m.Severity),
+		"component": string(m.Component),
+		"context":   m.Context,
+		"message":   m.LogMessage,
+	})
+
+	if m.ConnectionInfo == nil || m.ConnectionInfo.ConnectionId != "[conn12]" {
+		t.Errorf("expected connection info not there")
+	}
+	if m.ConnectionInfo != nil && (m.ConnectionInfo.AppName != "catpics-api" ||
+		m.ConnectionInfo.DriverName != "PyMongo" || m.ConnectionInfo.DriverVersion != "3.11.0") {
+		t.Errorf("unexpected client metadata: %+v", m.ConnectionInfo)
+	}
+	if m.Command != "find" || m.Namespace != "FooDb.mycatpicscollection" {
+		t.Errorf("unexpected command %v on %v", m.Command, m.Namespace)
+	}
+	expectStats := ExecStats{
+		KeysExamined:    50314,
+		DocsExamined:    2,
+		NReturned:       2,
+		NumYields:       393,
+		ResLen:          14980,
+		CursorExhausted: true,
+		Duration:        219 * time.Millisecond,
+		Protocol:        "op_msg",
+	}
+	if m.ExecStats == nil || *m.ExecStats != expectStats {
+		t.Errorf("unexpected exec stats: %+v", m.ExecStats)
+	}
+	if m.Locks["Global"]["r"].AcquireCount != 788 {
+		t.Errorf("unexpected locks: %+v", m.Locks)
+	}
+	if m.PlanInfo == nil || len(m.PlanInfo.Items) != 1 || m.PlanInfo.Items[0].PlanType != "IXSCAN" {
+		t.Errorf("unexpected plan info: %+v", m.PlanInfo)
+	}
+
+	params := m.CommandParameters
+	if s, ok := params.GetString("find"); !ok || s != "mycatpicscollection" {
+		t.Errorf("find mismatch, got %v", s)
+	}
+	if s, ok := params.GetString("filter.foo.category.$in.0"); !ok || s != "alley" {
+		t.Errorf("filter.foo.category.$in.0 mismatch, got %v", s)
+	}
+	if n, ok := params.GetNumber("filter.foo.max_time.$gte"); !ok || n != 1534769530.5 {
+		t.Errorf("filter.foo.max_time.$gte mismatch, got %v", n)
+	}
+
+	// Extended JSON wrappers are turned into the same values as in the text logs
+	objectId := params.Get("filter.foo.FooObjectId")
+	if objectId == nil || objectId.Kind != KindFunction || objectId.FuncValue.FuncName != "ObjectId" ||
+		objectId.FuncValue.FuncArgs[0].StringValue != "5a8c3a142053a407a936745e" {
+		t.Errorf("filter.foo.FooObjectId mismatch, got %+v", objectId)
+	}
+	when := params.Get("filter.foo.when")
+	if when == nil || when.Kind != KindFunction || when.FuncValue.FuncName != "Date" ||
+		when.FuncValue.FuncArgs[0].NumericValue != 1538978461000 {
+		t.Errorf("filter.foo.when mismatch, got %+v", when)
+	}
+	if uuid := params.Get("lsid.id"); uuid == nil || uuid.Kind != KindFunction || uuid.FuncValue.FuncName != "UUID" {
+		t.Errorf("lsid.id mismatch, got %+v", uuid)
+	}
+
+	m, err = ParseLogEntry(parser, endConnectionMessage)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if m.ConnectionInfo == nil || m.ConnectionInfo.ConnectionId != "[conn12]" {
+		t.Errorf("expected connection info not there")
+	}
+	if _, ok := parser.Connections().Lookup("[conn12]"); ok {
+		t.Errorf("connection should have been closed")
+	}
+}
+
+func TestJsonToPseudoJsonBinary(t *testing.T) {
+	doc, err := jsonToPseudoJson([]byte(`{"a":{"$binary":{"base64":"AQID","subType":"06"}},` +
+		`"b":{"$binary":"AQI=","$type":"00"},"c":{"$numberLong":"42"},"d":{"$timestamp":{"t":1,"i":2}}}`))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+
+	if a := doc.Get("a"); a == nil || a.Kind != KindBinData || a.BinDataValue.Subtype != 6 ||
+		string(a.BinDataValue.Data) != "\x01\x02\x03" {
+		t.Errorf("a mismatch, got %+v", a)
+	}
+	if b := doc.Get("b"); b == nil || b.Kind != KindBinData || string(b.BinDataValue.Data) != "\x01\x02" {
+		t.Errorf("b mismatch, got %+v", b)
+	}
+	if n, ok := doc.GetNumber("c"); !ok || n != 42 {
+		t.Errorf("c mismatch, got %v", n)
+	}
+	if d := doc.Get("d"); d == nil || d.Kind != KindFunction || d.FuncValue.FuncName != "Timestamp" {
+		t.Errorf("d mismatch, got %+v", d)
+	}
+}
+
+func TestJsonToPseudoJsonDate(t *testing.T) {
+	doc, err := jsonToPseudoJson([]byte(`{"a":{"$date":"2018-10-08T06:01:01Z"},` +
+		`"b":{"$date":{"$numberLong":"1538978461000"}}}`))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+
+	for _, key := range []string{"a", "b"} {
+		v := doc.Get(key)
+		if v == nil || v.Kind != KindFunction || v.FuncValue.FuncName != "Date" ||
+			len(v.FuncValue.FuncArgs) != 1 || v.FuncValue.FuncArgs[0].NumericValue != 1538978461000 {
+			t.Errorf("%v mismatch, got %+v", key, v)
+		}
+	}
+	expect := `{"a":{"$date":{"$numberLong":"1538978461000"}},"b":{"$date":{"$numberLong":"1538978461000"}}}`
+	if canonical, err := doc.ToExtendedJSON(true); err != nil || string(canonical) != expect {
+		t.Errorf("canonical mismatch:\nexpect: %v\nvalue : %s %v\n", expect, canonical, err)
+	}
+}
@@ -0,0 +1,83 @@
+package mongolog
+
+import (
+	"fmt"
+)
+
+// LockModeStats are the lock counters of a single lock mode (r, w, R, W)
+type LockModeStats struct {
+	AcquireCount        int64
+	AcquireWaitCount    int64
+	TimeAcquiringMicros int64
+	DeadlockCount       int64
+}
+
+// LockStats are the lock counters keyed by resource (Global, Database, Collection, oplog, ...)
+// and lock mode
+type LockStats map[string]map[string]LockModeStats
+
+// WaitMicros returns the total time spent waiting for the locks of the resource
+func (locks LockStats) WaitMicros(resource string) (total int64) {
+	for _, stats := range locks[resource] {
+		total += stats.TimeAcquiringMicros
+	}
+	return
+}
+
+// Contended reports whether any of the locks had to be waited for
+func (locks LockStats) Contended() bool {
+	for _, modes := range locks {
+		for _, stats := range modes {
+			if stats.AcquireWaitCount > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseLockStats parses the locks document, ie. { Global: { acquireCount: { r: 788 } }, ... }
+func ParseLockStats(parser MongoLogParser, message string) (LockStats, error) {
+	doc, err := ParsePseudoJson(parser, message)
+	if err != nil {
+		return nil, err
+	}
+	return lockStatsFromDocument(doc)
+}
+
+func lockStatsFromDocument(doc *PseudoJson) (LockStats, error) {
+	locks := make(LockStats)
+	for _, resource := range doc.Elements {
+		if resource.Val.Kind != KindDocument {
+			return nil, fmt.Errorf("%v: expecting a document", resource.Key)
+		}
+
+		modes := make(map[string]LockModeStats)
+		for _, counter := range resource.Val.Nested.Elements {
+			if counter.Val.Kind != KindDocument {
+				return nil, fmt.Errorf("%v.%v: expecting a document", resource.Key, counter.Key)
+			}
+
+			for _, mode := range counter.Val.Nested.Elements {
+				if mode.Val.Kind != KindNumber {
+					continue
+				}
+				stats := modes[mode.Key]
+				value := int64(mode.Val.NumericValue)
+				switch counter.Key {
+				case "acquireCount":
+					stats.AcquireCount = value
+				case "acquireWaitCount":
+					stats.AcquireWaitCount = value
+				case "timeAcquiringMicros":
+					stats.TimeAcquiringMicros = value
+				case "deadlockCount":
+					stats.DeadlockCount = value
+				}
+				modes[mode.Key] = stats
+			}
+		}
+		locks[resource.Key] = modes
+	}
+	return locks, nil
+}
@@ -0,0 +1,95 @@
+package mongolog
+
+import (
+	"testing"
+)
+
+func TestParseLockStats(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	message := `{ Global: { acquireCount: { r: 2, w: 2 } }, Database: { acquireCount: { w: 2 },` +
+		` acquireWaitCount: { w: 1 }, timeAcquiringMicros: { w: 12259 } }, Collection:` +
+		` { acquireCount: { w: 1 } }, oplog: { acquireCount: { w: 1 } } }`
+
+	locks, err := ParseLockStats(parser, message)
+	if err != nil {
+		t.Errorf("unable to parse locks: %v", err)
+		return
+	}
+
+	expectLocks := map[string]map[string]LockModeStats{
+		"Global":     {"r": {AcquireCount: 2}, "w": {AcquireCount: 2}},
+		"Database":   {"w": {AcquireCount: 2, AcquireWaitCount: 1, TimeAcquiringMicros: 12259}},
+		"Collection": {"w": {AcquireCount: 1}},
+		"oplog":      {"w": {AcquireCount: 1}},
+	}
+	for resource, modes := range expectLocks {
+		for mode, stats := range modes {
+			if locks[resource][mode] != stats {
+				t.Errorf("%v.%v: expected %+v, got %+v", resource, mode, stats, locks[resource][mode])
+			}
+		}
+		if len(locks[resource]) != len(modes) {
+			t.Errorf("%v: unexpected modes: %+v", resource, locks[resource])
+		}
+	}
+
+	if !locks.Contended() {
+		t.Errorf("expected the locks to be contended")
+	}
+	if w := locks.WaitMicros("Database"); w != 12259 {
+		t.Errorf("unexpected Database wait: %v", w)
+	}
+}
+
+func TestLogEntryLockStats(t *testing.T) {
+	logLine := `2018-10-08T06:18:34.281+0000 I COMMAND  [conn206777] command FooDb.mycatpicscollection` +
+		` command: insert { insert: "mycatpicscollection", ordered: true, locks: { a: 1 }, $db: "FooDb" }` +
+		` ninserted:1 keysInserted:3 numYields:0 reslen:229 locks:{ Global: { acquireCount: { r: 2, w: 2 } },` +
+		` Collection: { acquireCount: { w: 1 } } } protocol:op_query 12ms`
+
+	parser, _ := NewLogParser()
+	m, err := ParseLogEntry(parser, logLine)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+
+	if m.Locks["Global"]["w"].AcquireCount != 2 || m.Locks["Collection"]["w"].AcquireCount != 1 {
+		t.Errorf("unexpected locks: %+v", m.Locks)
+	}
+	if m.Locks.Contended() {
+		t.Errorf("expected the locks to be uncontended")
+	}
+}
+
+func TestLogEntryBrokenLockStats(t *testing.T) {
+	logLines := []string{
+		`2018-10-08T06:18:34.281+0000 I COMMAND  [conn206777] command FooDb.mycatpicscollection` +
+			` command: find { find: "mycatpicscollection", filter: { a: 1 } } planSummary: COLLSCAN` +
+			` keysExamined:0 docsExamined:10 nreturned:1 reslen:229 locks:{ Global: { acquireCount: { r: ? } } }` +
+			` protocol:op_msg 12ms`,
+		`{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"COMMAND","id":51803,` +
+			`"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"FooDb.mycatpicscollection",` +
+			`"command":{"find":"mycatpicscollection","filter":{"a":1}},"planSummary":"COLLSCAN",` +
+			`"nreturned":1,"locks":{"Global":"r"},"durationMillis":12}}`,
+	}
+
+	// The entry is kept without the locks in the strict mode too
+	parser, _ := NewLogParser()
+	for _, logLine := range logLines {
+		m, err := parser.Parse(logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		if m.Locks != nil {
+			t.Errorf("expected no locks, got %v", m.Locks)
+		}
+		if m.ExecStats == nil || m.ExecStats.NReturned != 1 || m.CommandParameters == nil {
+			t.Errorf("unexpected entry: %+v", m)
+		}
+		if len(m.Warnings) != 1 || m.Warnings[0].Stage != StageLocks {
+			t.Errorf("unexpected warnings: %v", m.Warnings)
+		}
+	}
+}
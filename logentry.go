@@ -1,37 +1,127 @@
 package mongolog
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type MongoLogEntry struct {
 	Timestamp         string
-	Severity          string
-	Component         string
+	Time              time.Time
+	Severity          Severity
+	Component         Component
 	Context           string
 	LogMessage        string
+	Namespace         string
+	Command           string
 	ConnectionInfo    *Connection
+	ConnectionEvent   ConnectionEvent
 	CommandParameters *PseudoJson
 	PlanInfo          *PlanSummary
+	ExecStats         *ExecStats
+	Locks             LockStats
+	// Warnings are the parts of the entry that failed to parse in the lenient mode, and the
+	// timestamp, lock stats and client metadata that failed to parse in either mode
+	Warnings []*ParseError
+	// Truncated is set if Mongo left out a part of the entry, the documents have what was left
+	Truncated bool
+	// OriginalSize is the size of the truncated log line in bytes as reported by Mongo, in kB
+	// precision. It's 0 if only parts of the documents were left out.
+	OriginalSize int
+
+	// Where the LogMessage starts in the log line, -1 for the JSON logs
+	messageOffset int
+	// Where the execution stats are searched from in the LogMessage, after the command documents
+	statsOffset int
 }
 
 type Connection struct {
 	ConnectionId string
 	IpAddress    string
 	Port         string
+
+	// From the client metadata that the drivers send when connecting
+	AppName        string
+	DriverName     string
+	DriverVersion  string
+	OSType         string
+	OSName         string
+	OSArchitecture string
+	OSVersion      string
+	Platform       string
+	Metadata       *PseudoJson
 }
 
+// LogParser parses the log lines into MongoLogEntry values and keeps track of the connections
+// so that the entries can be enriched with the client information.
+//
+// A LogParser is safe for concurrent use. Connection state is updated as the connection events
+// are parsed, so for the enrichment to be correct the lines of a single log must be parsed in
+// order. Logs of different mongod instances must not share the connection state as the
+// connection ids would clash. Parse them with separate parsers, or use NewLogParserWithState to
+// share the state deliberately.
 type LogParser struct {
 	commandParametersParser MongoLogParser
 	planSummaryParser       MongoLogParser
 	connectionMetaParser    MongoLogParser
 
-	connectionMap map[string]*Connection
+	connections *ConnectionState
+	lenient     bool
+	year        int
+	location    *time.Location
+}
+
+// LogParserOptions configures the LogParser
+type LogParserOptions struct {
+	// State is the connection state to use, the parser gets its own if nil
+	State *ConnectionState
+	// FastPseudoJson selects the hand-written parser for the command parameters
+	FastPseudoJson bool
+	// Lenient keeps what can be parsed of the entries instead of failing them. The values that
+	// can't be parsed are kept as KindRaw values and the failures recorded in the Warnings.
+	Lenient bool
+	// DefaultYear and DefaultLocation are used for the ctime timestamps that have neither. The
+	// current year and the local time zone are used by default.
+	DefaultYear     int
+	DefaultLocation *time.Location
+}
+
+// NewLogParser returns a parser with its own connection state
+func NewLogParser() (*LogParser, error) {
+	return NewLogParserWithOptions(LogParserOptions{})
 }
 
-func NewLogParser() (parser LogParser, err error) {
-	parser.commandParametersParser, err = NewCommandParametersParser()
+// NewLogParserWithState returns a parser that uses the given connection state
+func NewLogParserWithState(state *ConnectionState) (*LogParser, error) {
+	return NewLogParserWithOptions(LogParserOptions{State: state})
+}
+
+func NewLogParserWithOptions(options LogParserOptions) (parser *LogParser, err error) {
+	parser = &LogParser{
+		connections: options.State,
+		lenient:     options.Lenient,
+		year:        options.DefaultYear,
+		location:    options.DefaultLocation,
+	}
+	if parser.connections == nil {
+		parser.connections = NewConnectionState()
+	}
+	if parser.year == 0 {
+		parser.year = time.Now().Year()
+	}
+	if parser.location == nil {
+		parser.location = time.Local
+	}
+
+	newPseudoJsonParser := NewCommandParametersParser
+	if options.FastPseudoJson {
+		newPseudoJsonParser = NewFastPseudoJsonParser
+	}
+
+	parser.commandParametersParser, err = newPseudoJsonParser()
 	if err != nil {
 		return parser, fmt.Errorf("Cannot initialize commandParametersParser: %v", err)
 	}
@@ -41,92 +131,260 @@ func NewLogParser() (parser LogParser, err error) {
 		return parser, fmt.Errorf("Cannot initialize planSummaryParser: %v", err)
 	}
 
-	parser.connectionMetaParser, err = NewCommandParametersParser()
+	parser.connectionMetaParser, err = newPseudoJsonParser()
 	if err != nil {
 		return parser, fmt.Errorf("Cannot initialize connectionMetaParser: %v", err)
 	}
 
-	parser.connectionMap = make(map[string]*Connection)
 	return
 }
 
-func handleNewConnection(parser LogParser, entry *MongoLogEntry, connParams map[string]string) {
+// tolerate records the error as a warning of the entry in the lenient mode, otherwise returns it
+func (parser *LogParser) tolerate(entry *MongoLogEntry, err *ParseError) error {
+	if !parser.lenient {
+		return err
+	}
+	entry.Warnings = append(entry.Warnings, err)
+	return nil
+}
+
+// parseDocument parses the pseudo JSON input found at offset of the log message. In the lenient
+// mode a failure is retried with the lenient parser that keeps the broken values as raw text.
+func (parser *LogParser) parseDocument(mongoParser MongoLogParser, stage ParseStage, entry *MongoLogEntry,
+	offset int, input string) (*PseudoJson, error) {
+	if strings.Contains(input, "...") {
+		if repaired, truncated := repairTruncatedDocument(input, false); truncated {
+			input = repaired
+			entry.Truncated = true
+		}
+	}
+
+	doc, err := ParsePseudoJson(mongoParser, input)
+	if err == nil {
+		return doc, nil
+	}
+	if !parser.lenient {
+		return nil, newParseError(stage, entry, offset, err)
+	}
+
+	doc, warnings, err := parseLenientPseudoJson(input)
+	for _, w := range warnings {
+		entry.Warnings = append(entry.Warnings, newParseError(stage, entry, offset, w))
+	}
+	if err != nil {
+		entry.Warnings = append(entry.Warnings, newParseError(stage, entry, offset, err))
+	}
+	return doc, nil
+}
+
+// Connections returns the connection state of the parser
+func (parser *LogParser) Connections() *ConnectionState {
+	return parser.connections
+}
+
+func handleNewConnection(parser *LogParser, entry *MongoLogEntry, connParams map[string]string) {
 	conn := &Connection{
 		ConnectionId: "[conn" + connParams["id"] + "]",
 		IpAddress:    connParams["ip"],
 		Port:         connParams["port"],
 	}
-	parser.connectionMap[conn.ConnectionId] = conn
+	parser.connections.open(conn)
 	entry.ConnectionInfo = conn
+	entry.ConnectionEvent = ConnectionOpened
 }
 
-func handleCloseConnection(parser LogParser, entry *MongoLogEntry) {
-	if conn, ok := parser.connectionMap[entry.Context]; ok {
+// handleCloseConnection closes the connection of the entry's context. The connections opened before
+// the log started are not known, for these the client address is taken from the log line.
+func handleCloseConnection(parser *LogParser, entry *MongoLogEntry, connParams map[string]string) {
+	entry.ConnectionEvent = ConnectionClosed
+	if conn, ok := parser.connections.close(entry.Context); ok {
 		entry.ConnectionInfo = conn
-		delete(parser.connectionMap, entry.Context)
+	} else {
+		entry.ConnectionInfo = &Connection{
+			ConnectionId: entry.Context,
+			IpAddress:    connParams["ip"],
+			Port:         connParams["port"],
+		}
 	}
 }
 
-func handleConnectionMetadata(parser LogParser, entry MongoLogEntry, connParams map[string]string) {
-	if conn, ok := parser.connectionMap[entry.Context]; ok {
-		// Parse the metadata payload and add to connection
-		connMeta, err := ParsePseudoJson(parser.connectionMetaParser, connParams["metadata"])
-		if err == nil {
-			_ = conn
-			_ = connMeta
+func handleConnectionMetadata(parser *LogParser, entry *MongoLogEntry, connMeta *PseudoJson) {
+	entry.ConnectionEvent = ConnectionIdentified
+	parser.connections.update(entry.Context, func(conn *Connection) {
+		conn.Metadata = connMeta
+		conn.AppName, _ = connMeta.GetString("application.name")
+		conn.DriverName, _ = connMeta.GetString("driver.name")
+		conn.DriverVersion, _ = connMeta.GetString("driver.version")
+		conn.OSType, _ = connMeta.GetString("os.type")
+		conn.OSName, _ = connMeta.GetString("os.name")
+		conn.OSArchitecture, _ = connMeta.GetString("os.architecture")
+		conn.OSVersion, _ = connMeta.GetString("os.version")
+		conn.Platform, _ = connMeta.GetString("platform")
+	})
+}
+
+// handleLegacyOperation handles the pre-command style operation lines, ie.
+// query db.coll query: { ... } planSummary: ... or update db.coll query: { ... } update: { ... }
+// The query, command and update documents are parsed into CommandParameters under the same keys.
+func handleLegacyOperation(parser *LogParser, entry *MongoLogEntry, op map[string]string) (err error) {
+	entry.Namespace = op["collection"]
+	entry.Command = op["operation"]
+	message := op["payload"]
+	payloadOffset := len(entry.LogMessage) - len(message)
+
+	// The documents are parsed together, keep track of where they came from for the errors
+	var params []string
+	var paramsOffsets []int
+	pos := 0
+	for _, key := range []string{"query", "command", "update"} {
+		// Only the top level keys, the documents can have keys of the same name
+		start := topLevelIndex(message[pos:], key+": {")
+		if start < 0 {
+			continue
+		}
+		start += pos + len(key) + 2
+
+		doc, end, ok := extractEntryDocument(entry, payloadOffset+start)
+		if !ok {
+			return parser.tolerate(entry, newParseError(StageCommandParams, entry, payloadOffset+start,
+				fmt.Errorf("%v: document not closed", key)))
+		}
+		params = append(params, key+": "+doc)
+		paramsOffsets = append(paramsOffsets, payloadOffset+start-len(key)-2)
+		pos = end - payloadOffset
+
+		// The plan summary sits between the query and the update documents
+		if key != "update" {
+			if plan := strings.Index(message[pos:], "planSummary: "); plan >= 0 {
+				plan += pos + len("planSummary: ")
+				entry.PlanInfo, err = ParsePlanSummary(parser.planSummaryParser, message[plan:])
+				if err != nil {
+					entry.PlanInfo = nil
+					err = parser.tolerate(entry, newParseError(StagePlanSummary, entry, payloadOffset+plan, err))
+					if err != nil {
+						return
+					}
+				}
+			}
 		}
 	}
-}
 
-func handleFindCommand(parser LogParser, entry *MongoLogEntry) (err error) {
-	commandBody := RegexpMatch(MongoLogCommandPayloadRegex, entry.LogMessage)
-	if commandBody == nil {
-		return fmt.Errorf("COMMAND payload does not match expected.")
+	if len(params) == 0 {
+		return
 	}
+	entry.statsOffset = payloadOffset + pos
 
-	entry.CommandParameters, err = ParseCommandParameters(parser.commandParametersParser,
-		commandBody["commandparams"])
-	if err != nil {
-		return fmt.Errorf("commandparams: parse error: %v", err)
+	// Braces needed, otherwise the mixed mode grammar nests the update into the query
+	joined := "{ " + strings.Join(params, ", ") + " }"
+	if strings.Contains(joined, "...") {
+		if repaired, truncated := repairTruncatedDocument(joined, false); truncated {
+			joined = repaired
+			entry.Truncated = true
+		}
+	}
+	entry.CommandParameters, err = ParseCommandParameters(parser.commandParametersParser, joined)
+	if err == nil {
+		return
+	}
+	entry.CommandParameters = nil
+	if !parser.lenient {
+		return legacyParamsError(entry, params, paramsOffsets, err)
 	}
 
-	entry.PlanInfo, err = ParsePlanSummary(parser.planSummaryParser,
-		commandBody["plansummary"])
+	doc, warnings, err := parseLenientPseudoJson(joined)
+	entry.CommandParameters = doc
 	if err != nil {
-		return fmt.Errorf("plansummary: pare error: %v", err)
+		warnings = append(warnings, err)
 	}
-
-	return
+	for _, w := range warnings {
+		entry.Warnings = append(entry.Warnings, legacyParamsError(entry, params, paramsOffsets, w))
+	}
+	return nil
 }
 
-func handleOtherCommand(parser LogParser, entry *MongoLogEntry) (err error) {
-	commandBody := RegexpMatch(MongoLogOtherPayloadRegex, entry.LogMessage)
-	if commandBody == nil {
-		return fmt.Errorf("COMMAND payload does not match expected.")
+// legacyParamsError maps the error position in the joined legacy documents back to the message
+func legacyParamsError(entry *MongoLogEntry, params []string, offsets []int, err error) *ParseError {
+	perr, ok := err.(*ParseError)
+	if !ok {
+		return newParseError(StageCommandParams, entry, offsets[0], err)
 	}
 
-	entry.CommandParameters, err = ParseCommandParameters(parser.commandParametersParser,
-		commandBody["commandparams"])
-	if err != nil {
-		return fmt.Errorf("commandparams: parse error: %v", err)
+	pos := len("{ ")
+	for i, param := range params {
+		if perr.Offset < pos+len(param) || i == len(params)-1 {
+			relative := perr.Offset - pos
+			if relative < 0 {
+				relative = 0
+			} else if relative > len(param) {
+				relative = len(param)
+			}
+			return newParseError(StageCommandParams, entry, offsets[i],
+				&ParseError{Offset: relative, Token: perr.Token, Err: perr.Err})
+		}
+		pos += len(param) + len(", ")
 	}
+	return newParseError(StageCommandParams, entry, offsets[0], err)
+}
 
-	return
+// withLine sets the log line of the ParseError and the warnings of the entry
+func withLine(entry *MongoLogEntry, err error, logLine string) error {
+	if perr, ok := err.(*ParseError); ok && perr.Line == "" {
+		perr.Line = logLine
+	}
+	for _, w := range entry.Warnings {
+		if w.Line == "" {
+			w.Line = logLine
+		}
+	}
+	return err
+}
+
+// ParseLogEntry parses the MongoDb log line into MongoLogEntry structure, same as parser.Parse
+func ParseLogEntry(parser *LogParser, logLine string) (result MongoLogEntry, err error) {
+	return parser.Parse(logLine)
 }
 
-// ParseLogEntry parses the MongoDb log line into MongoLogEntry structure
-func ParseLogEntry(parser LogParser, logLine string) (result MongoLogEntry, err error) {
+// Parse parses the MongoDb log line into MongoLogEntry structure. Both the text and the 4.4+
+// JSON log formats are supported, the format is detected for every line.
+func (parser *LogParser) Parse(logLine string) (result MongoLogEntry, err error) {
+	result, body, err := parser.parseHeader(logLine)
+	if err == nil && body != nil {
+		err = body(&result)
+	}
+	return result, withLine(&result, err, logLine)
+}
+
+// bodyParser completes an entry that has been through parseHeader
+type bodyParser func(entry *MongoLogEntry) error
+
+// parseHeader does the part of the parsing that needs to happen in log order: the header, the
+// connection tracking and enrichment. The rest, ie. the command parameters, is left to the
+// returned bodyParser which only depends on the entry. The body is nil if there's nothing left.
+func (parser *LogParser) parseHeader(logLine string) (result MongoLogEntry, body bodyParser, err error) {
+	if isJsonLogLine(logLine) {
+		return parseJsonLogHeader(parser, logLine)
+	}
+
 	logMatch := RegexpMatch(MongoLoglineRegex, logLine)
 	if logMatch == nil {
-		return result, fmt.Errorf("logLine does not match Mongo log pattern.")
+		return result, nil, &ParseError{Stage: StageHeader, Offset: 0, Token: tokenAt(logLine, 0),
+			Err: errors.New("logLine does not match Mongo log pattern")}
 	}
 	result.Timestamp = logMatch["timestamp"]
-	result.Severity = logMatch["severity"]
-	result.Component = logMatch["component"]
+	// The entry is kept with a zero Time if the timestamp is not understood, in the strict mode too
+	result.Time, err = ParseTimestamp(result.Timestamp, parser.year, parser.location)
+	if err != nil {
+		result.Warnings = append(result.Warnings, &ParseError{Stage: StageHeader, Offset: 0,
+			Token: result.Timestamp, Err: err})
+		err = nil
+	}
+	result.Severity = Severity(logMatch["severity"])
+	result.Component = Component(logMatch["component"])
 	result.Context = logMatch["context"]
 	result.LogMessage = logMatch["message"]
+	result.messageOffset = len(logLine) - len(result.LogMessage)
 
-	if result.Component == "NETWORK" {
+	if result.Component == ComponentNetwork {
 		if result.Context == "[listener]" {
 			connParams := RegexpMatch(MongoNewConnectionRegex, result.LogMessage)
 			if connParams != nil {
@@ -135,73 +393,103 @@ func ParseLogEntry(parser LogParser, logLine string) (result MongoLogEntry, err
 		} else {
 			connParams := RegexpMatch(MongoConnectionMetadataRegex, result.LogMessage)
 			if connParams != nil {
-				handleConnectionMetadata(parser, result, connParams)
+				connMeta, err := parser.parseDocument(parser.connectionMetaParser, StageConnection, &result,
+					len(result.LogMessage)-len(connParams["metadata"]), connParams["metadata"])
+				if perr, ok := err.(*ParseError); ok {
+					// The entry is kept without the metadata, in the strict mode too
+					result.Warnings = append(result.Warnings, perr)
+				} else if connMeta != nil {
+					handleConnectionMetadata(parser, &result, connMeta)
+				}
 			} else {
 				connParams := RegexpMatch(MongoEndConnectionRegex, result.LogMessage)
 				if connParams != nil {
-					handleCloseConnection(parser, &result)
+					handleCloseConnection(parser, &result, connParams)
 				}
 			}
 		}
 	}
 
 	// Enrich the logentry with connection information
-	if conn, ok := parser.connectionMap[result.Context]; ok {
+	if conn, ok := parser.connections.Lookup(result.Context); ok {
 		result.ConnectionInfo = conn
 	}
 
-	if strings.HasPrefix(result.LogMessage, "warning") {
-		return result, nil
+	if result.Component == ComponentCommand || result.Component == ComponentWrite {
+		body = parser.parseBody
 	}
+	return
+}
 
-	if result.Severity != "I" || result.Component != "COMMAND" {
-		return result, nil
+// parseBody parses the execution stats, locks and command parameters of COMMAND and WRITE entries
+func (parser *LogParser) parseBody(result *MongoLogEntry) (err error) {
+	// The legacy operations are matched from the start of the message, after the warning if any
+	message := result.LogMessage
+	// The stats are at the end, after the cut if the line was truncated
+	tail := 0
+	if loc := MongoTruncatedLineRegex.FindStringSubmatchIndex(message); loc != nil {
+		result.Truncated = true
+		size, _ := strconv.Atoi(message[loc[2]:loc[3]])
+		result.OriginalSize = size * 1024
+		message = message[loc[1]:]
+		if cut := strings.Index(result.LogMessage, truncationSeparator); cut >= 0 {
+			tail = cut + len(truncationSeparator)
+		}
 	}
 
-	// Make BinData parseable with regexs while don't know how to properly parse it
-	result.LogMessage = ReplaceBinData(result.LogMessage)
+	// The entry is kept without the lock stats if they fail to parse, in the strict mode too
+	if loc := MongoLocksRegex.FindStringIndex(result.LogMessage[tail:]); loc != nil {
+		start := tail + loc[1] - 1
+		var lockErr error
+		if locks, ok := ExtractDocument(result.LogMessage, start); !ok {
+			lockErr = errors.New("document not closed")
+		} else if result.Locks, lockErr = ParseLockStats(parser.commandParametersParser, locks); lockErr != nil {
+			result.Locks = nil
+		}
+		if lockErr != nil {
+			result.Warnings = append(result.Warnings, newParseError(StageLocks, result, start, lockErr))
+		}
+	}
+
+	if err = parser.parseOperation(result, message); err != nil {
+		return
+	}
+
+	// The documents can have key:value strings of their own, the stats are after them
+	if result.statsOffset < tail {
+		result.statsOffset = tail
+	}
+	result.ExecStats = ParseExecStats(result.LogMessage[result.statsOffset:])
+	return nil
+}
+
+// parseOperation parses the command parameters and plan of the legacy operation or the command,
+// from the message that has the truncation warning left out
+func (parser *LogParser) parseOperation(result *MongoLogEntry, message string) error {
+	if strings.HasPrefix(message, "warning") || result.Severity != Info {
+		return nil
+	}
+
+	if legacyOp := RegexpMatch(MongoLegacyOperationRegex, message); legacyOp != nil {
+		return handleLegacyOperation(parser, result, legacyOp)
+	}
+
+	if result.Component != ComponentCommand {
+		return nil
+	}
 
 	// Parse the command parameters and execution plan
-	// TODO: Handle "query" commands which have a slightly different layout
 	commandInfo := RegexpMatch(MongoLogCommandInfo, result.LogMessage)
 	if commandInfo == nil {
-		return result, fmt.Errorf("Command info not found")
-	}
-
-	switch commandInfo["command"] {
-	case "isMaster":
-		fallthrough
-	case "delete":
-		fallthrough
-	case "listCollections":
-		fallthrough
-	case "serverStatus":
-		fallthrough
-	case "replSetUpdatePosition":
-		fallthrough
-	case "dbStats":
-		fallthrough
-	case "collStats":
-		fallthrough
-	case "insert":
-		fallthrough
-	case "update":
-		err = handleOtherCommand(parser, &result)
-	case "count":
-		fallthrough
-	case "getMore":
-		fallthrough
-	case "findAndModify":
-		fallthrough
-	case "aggregate":
-		fallthrough
-	case "query":
-		fallthrough
-	case "find":
-		err = handleFindCommand(parser, &result)
-	default:
-		return result, fmt.Errorf("Unknown command: %v", commandInfo["command"])
+		return parser.tolerate(result, newParseError(StageCommandInfo, result, 0,
+			errors.New("command info not found")))
 	}
+	result.Namespace = commandInfo["collection"]
+	result.Command = commandInfo["command"]
 
-	return
+	handler, ok := LookupCommandHandler(result.Command)
+	if !ok {
+		handler = DefaultCommandHandler
+	}
+	return handler(parser, result)
 }
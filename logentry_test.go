@@ -1,14 +1,18 @@
 package mongolog
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseLogEntry(t *testing.T) {
 	newConnectionMessage := `2018-10-05T14:01:04.067+0000 I NETWORK  [listener]` +
 		` connection accepted from 10.178.5.250:47878 #2078609 (252 connections now open)`
 	clientMetadataMessage := `2018-10-05T14:01:04.067+0000 I NETWORK  [conn2078609]` +
-		` received client metadata from 10.178.5.250:47878 conn2078609: { driver: { name: "PyMongo" } }`
+		` received client metadata from 10.178.5.250:47878 conn2078609: { driver: { name: "PyMongo",` +
+		` version: "3.7.1" }, os: { type: "Linux", name: "Linux", architecture: "x86_64", version: "4.4.0" },` +
+		` platform: "CPython 3.6.6.final.0", application: { name: "catpics-api" } }`
 	commandMessage := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn2078609]` +
 		` command FooDb.mycatpicscollection command: find { find: "mycatpicscollection",` +
 		` filter: { foo.FooObjectId: ObjectId('5a8c3a142053a407a936745e'), foo.max_time:` +
@@ -49,7 +53,225 @@ func TestParseLogEntry(t *testing.T) {
 
 	m, err = ParseLogEntry(parser, commandMessage)
 	validateConnection(m, err)
+	expectClient := map[string]string{
+		"AppName":        "catpics-api",
+		"DriverName":     "PyMongo",
+		"DriverVersion":  "3.7.1",
+		"OSType":         "Linux",
+		"OSName":         "Linux",
+		"OSArchitecture": "x86_64",
+		"OSVersion":      "4.4.0",
+		"Platform":       "CPython 3.6.6.final.0",
+	}
+	if conn := m.ConnectionInfo; conn != nil {
+		checkExpectedValues(t, expectClient, map[string]string{
+			"AppName":        conn.AppName,
+			"DriverName":     conn.DriverName,
+			"DriverVersion":  conn.DriverVersion,
+			"OSType":         conn.OSType,
+			"OSName":         conn.OSName,
+			"OSArchitecture": conn.OSArchitecture,
+			"OSVersion":      conn.OSVersion,
+			"Platform":       conn.Platform,
+		})
+		if !conn.Metadata.Has("driver.name") {
+			t.Errorf("expected the raw client metadata")
+		}
+	}
+	if m.Command != "find" || m.Namespace != "FooDb.mycatpicscollection" {
+		t.Errorf("unexpected command %v on %v", m.Command, m.Namespace)
+	}
+	if m.ExecStats == nil || m.ExecStats.Duration != 219*time.Millisecond {
+		t.Errorf("unexpected exec stats: %+v", m.ExecStats)
+	}
 
 	m, err = ParseLogEntry(parser, endConnectionMessage)
 	validateConnection(m, err)
 }
+
+func TestParseBrokenConnectionMetadata(t *testing.T) {
+	logLines := []string{
+		`2018-10-05T14:01:04.067+0000 I NETWORK  [conn5] received client metadata from` +
+			` 10.178.5.250:47878 conn5: { driver: { name: * } }`,
+		`{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"NETWORK","id":51800,` +
+			`"ctx":"conn5","msg":"client metadata","attr":{"remote":"10.178.5.250:47878","client":"conn5",` +
+			`"doc":"PyMongo"}}`,
+	}
+
+	// The entry is kept without the metadata in the strict mode too
+	parser, _ := NewLogParser()
+	for _, logLine := range logLines {
+		m, err := parser.Parse(logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		if m.ConnectionEvent != NoConnectionEvent || m.ConnectionInfo != nil {
+			t.Errorf("unexpected connection: %v %+v", m.ConnectionEvent, m.ConnectionInfo)
+		}
+		if len(m.Warnings) != 1 || m.Warnings[0].Stage != StageConnection {
+			t.Errorf("unexpected warnings: %v", m.Warnings)
+		}
+	}
+}
+
+func TestParseLegacyOperations(t *testing.T) {
+	testMessages := []struct {
+		logLine   string
+		command   string
+		params    map[string]float64
+		plan      string
+		nreturned int64
+		nmodified int64
+	}{
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] query FooDb.mycatpicscollection` +
+				` query: { $query: { a: 1 }, $orderby: { b: -1 } } planSummary: IXSCAN { a: 1, b: -1 }` +
+				` ntoreturn:0 ntoskip:0 keysExamined:10 docsExamined:10 cursorExhausted:1 numYields:0` +
+				` nreturned:10 reslen:500 locks:{ Global: { acquireCount: { r: 2 } } } 5ms`,
+			command:   "query",
+			params:    map[string]float64{"query.$query.a": 1, "query.$orderby.b": -1},
+			plan:      "IXSCAN { a: 1, b: -1 }",
+			nreturned: 10,
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] getmore FooDb.mycatpicscollection` +
+				` query: { a: { $gte: 5 } } planSummary: COLLSCAN cursorid:12345 ntoreturn:0 keysExamined:0` +
+				` docsExamined:200 numYields:1 nreturned:101 reslen:4000 locks:{} 15ms`,
+			command:   "getmore",
+			params:    map[string]float64{"query.a.$gte": 5},
+			plan:      "COLLSCAN",
+			nreturned: 101,
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] update FooDb.mycatpicscollection` +
+				` query: { _id: 1 } planSummary: IDHACK update: { $set: { b: 2 } } keysExamined:1` +
+				` docsExamined:1 nMatched:1 nModified:1 numYields:0 locks:{ Global: { acquireCount: { w: 2 } } } 0ms`,
+			command:   "update",
+			params:    map[string]float64{"query._id": 1, "update.$set.b": 2},
+			plan:      "IDHACK",
+			nmodified: 1,
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] update FooDb.mycatpicscollection` +
+				` command: { q: { _id: 1 }, u: { $inc: { c: 1 } }, multi: false, upsert: false }` +
+				` planSummary: IDHACK keysExamined:1 docsExamined:1 nMatched:1 nModified:1 numYields:0 0ms`,
+			command:   "update",
+			params:    map[string]float64{"command.q._id": 1, "command.u.$inc.c": 1},
+			plan:      "IDHACK",
+			nmodified: 1,
+		},
+		{
+			// The nested query key comes before the top level command document
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] update FooDb.mycatpicscollection` +
+				` command: { q: { query: { a: 1 } }, u: { $set: { b: 2 } }, multi: false, upsert: false }` +
+				` planSummary: COLLSCAN keysExamined:0 docsExamined:10 nMatched:1 nModified:1 numYields:0 1ms`,
+			command:   "update",
+			params:    map[string]float64{"command.q.query.a": 1, "command.u.$set.b": 2},
+			plan:      "COLLSCAN",
+			nmodified: 1,
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] remove FooDb.mycatpicscollection` +
+				` query: { a: 3 } planSummary: COLLSCAN keysExamined:0 docsExamined:10 ndeleted:1 numYields:0 1ms`,
+			command: "remove",
+			params:  map[string]float64{"query.a": 3},
+			plan:    "COLLSCAN",
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] insert FooDb.mycatpicscollection` +
+				` query: { _id: ObjectId('5a8c3a142053a407a936745e'), a: 4 } ninserted:1 keysInserted:1` +
+				` numYields:0 locks:{ Global: { acquireCount: { w: 1 } } } 0ms`,
+			command: "insert",
+			params:  map[string]float64{"query.a": 4},
+		},
+	}
+
+	parser, _ := NewLogParser()
+	for _, v := range testMessages {
+		m, err := ParseLogEntry(parser, v.logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", v.logLine, err)
+			continue
+		}
+
+		if m.Command != v.command || m.Namespace != "FooDb.mycatpicscollection" {
+			t.Errorf("unexpected command %v on %v", m.Command, m.Namespace)
+		}
+		for path, expect := range v.params {
+			if n, ok := m.CommandParameters.GetNumber(path); !ok || n != expect {
+				t.Errorf("%v: %v: expected %v, got %v", v.command, path, expect, n)
+			}
+		}
+		hasQuery := false
+		for path := range v.params {
+			hasQuery = hasQuery || strings.HasPrefix(path, "query.")
+		}
+		if !hasQuery && m.CommandParameters.Get("query") != nil {
+			t.Errorf("%v: unexpected query parameters: %v", v.command, m.CommandParameters)
+		}
+
+		plan := ""
+		if m.PlanInfo != nil {
+			plan = m.PlanInfo.String()
+		}
+		if plan != v.plan {
+			t.Errorf("%v: expected plan %v, got %v", v.command, v.plan, plan)
+		}
+
+		if m.ExecStats == nil || m.ExecStats.NReturned != v.nreturned || m.ExecStats.NModified != v.nmodified {
+			t.Errorf("%v: unexpected exec stats: %+v", v.command, m.ExecStats)
+		}
+	}
+}
+
+func TestLenientParse(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.foo command: find` +
+		` { find: "foo", filter: { a: %%, b: 1 }, $db: "FooDb" } planSummary: IXSCAN { b: 1 }` +
+		` keysExamined:1 docsExamined:1 nreturned:1 reslen:100` +
+		` locks:{ Global: { acquireCount: { r: ? } } } 3ms`
+
+	strict, _ := NewLogParser()
+	if _, err := strict.Parse(logLine); err == nil {
+		t.Errorf("expected an error in the strict mode")
+	}
+
+	for _, fast := range []bool{false, true} {
+		parser, _ := NewLogParserWithOptions(LogParserOptions{Lenient: true, FastPseudoJson: fast})
+		m, err := parser.Parse(logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+
+		if m.Command != "find" || m.Namespace != "FooDb.foo" {
+			t.Errorf("unexpected command %v on %v", m.Command, m.Namespace)
+		}
+		if v := m.CommandParameters.Get("filter.a"); v == nil || v.Kind != KindRaw || v.StringValue != "%%" {
+			t.Errorf("expected filter.a to be raw, got %+v", v)
+		}
+		if n, ok := m.CommandParameters.GetNumber("filter.b"); !ok || n != 1 {
+			t.Errorf("filter.b mismatch, got %v %v", n, ok)
+		}
+		if m.PlanInfo == nil || m.PlanInfo.String() != "IXSCAN { b: 1 }" {
+			t.Errorf("unexpected plan: %v", m.PlanInfo)
+		}
+		if m.ExecStats == nil || m.ExecStats.Duration != 3*time.Millisecond {
+			t.Errorf("unexpected exec stats: %+v", m.ExecStats)
+		}
+		if m.Locks != nil {
+			t.Errorf("expected no locks, got %v", m.Locks)
+		}
+
+		stages := make(map[ParseStage]bool)
+		for _, w := range m.Warnings {
+			stages[w.Stage] = true
+			if w.Line != logLine || w.Offset < 0 {
+				t.Errorf("unexpected warning: %+v", w)
+			}
+		}
+		if len(stages) != 2 || !stages[StageCommandParams] || !stages[StageLocks] {
+			t.Errorf("unexpected warnings: %v", m.Warnings)
+		}
+	}
+}
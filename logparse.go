@@ -1,10 +1,31 @@
 package mongolog
 
 import (
-	_ "fmt"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
 )
 
+// The default text/scanner lexer has no notion of regex literals, so roll our own. Order matters
+// here, the first matching alternative wins.
+var pseudoJsonLexer = lexer.Must(lexer.Regexp(
+	`(\s+)` +
+		`|(?P<String>"(?:\\.|[^"\\])*"|'(?:\\.|[^'\\])*')` +
+		`|(?P<BinData>BinData\(\s*\d+\s*,\s*(?:"[^"]*"|'[^']*'|[\w+/=]*)\s*\))` +
+		`|(?P<Regex>/(?:\\.|[^/\\\n])+/[a-z]*)` +
+		`|(?P<Float>\d+\.\d+(?:[eE][-+]?\d+)?|\d+[eE][-+]?\d+)` +
+		`|(?P<Int>\d+)` +
+		`|(?P<Ident>[\pL_][\pL\pN_]*)` +
+		`|(?P<Punct>[^\s\pL\pN_])`))
+
+var binDataLiteralRegex = regexp.MustCompile(`^BinData\(\s*(\d+)\s*,\s*(.*?)\s*\)$`)
+
 type ElementMap map[string]*Value
 
 type PseudoJson struct {
@@ -14,17 +35,72 @@ type PseudoJson struct {
 	// the rest of it.
 	Elements []*KeyValue `(@@  { (@@ | "{" @@ { "," @@ } "}") }) | (("{" { @@ { ","  @@ } } "}" ) { @@ })`
 
-	// Key the elements by KeyValue for convenient access
-	elems ElementMap
+	// Key the elements by KeyValue for convenient access. Documents are ordered and can have
+	// duplicate keys, the first value of the key is kept here and the duplicate keys noted.
+	elems      ElementMap
+	duplicates []string
 }
 
+// PlanSummary is the list of plan stages, multiple stages for the $or queries
 type PlanSummary struct {
 	Items []*PlanItem `@@ { "," @@ }`
 }
 
 type PlanItem struct {
-	PlanType string      `@Ident` // Like IXSCAN or COLSCAN
-	PlanInfo *PseudoJson `@@`
+	PlanType string `@Ident` // Like IXSCAN or COLLSCAN
+	// KeyPattern is the index key pattern of the stage, in index order
+	KeyPattern []*IndexKey `[ "{" [ @@ { "," @@ } ] "}" ]`
+}
+
+// IndexKey is a field of the index key pattern
+type IndexKey struct {
+	Field string `@(("$" ("*" "*" | Ident) | Ident) { "." ("$" ("*" "*" | Ident) | Ident) }) ":"`
+	Value *Value `@@`
+
+	// Direction is 1 or -1 for the regular index keys and 0 for the special index types
+	Direction int
+	// Type is the special index type such as "text", "2dsphere" or "hashed"
+	Type string
+}
+
+func (k *IndexKey) String() string {
+	if k.Type != "" {
+		return fmt.Sprintf("%v: %q", k.Field, k.Type)
+	}
+	return fmt.Sprintf("%v: %d", k.Field, k.Direction)
+}
+
+// HasStage reports whether any of the plan items is of the given stage, eg. COLLSCAN
+func (plan *PlanSummary) HasStage(stage string) bool {
+	if plan == nil {
+		return false
+	}
+	for _, item := range plan.Items {
+		if item.PlanType == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the plan summary the way Mongo logs it
+func (plan *PlanSummary) String() string {
+	items := make([]string, 0, len(plan.Items))
+	for _, item := range plan.Items {
+		items = append(items, item.String())
+	}
+	return strings.Join(items, ", ")
+}
+
+func (item *PlanItem) String() string {
+	if item.KeyPattern == nil {
+		return item.PlanType
+	}
+	keys := make([]string, 0, len(item.KeyPattern))
+	for _, k := range item.KeyPattern {
+		keys = append(keys, k.String())
+	}
+	return item.PlanType + " { " + strings.Join(keys, ", ") + " }"
 }
 
 type KeyValue struct {
@@ -33,14 +109,101 @@ type KeyValue struct {
 	Val *Value `@@`
 }
 
+// ValueKind tells which of the Value fields holds the value
+type ValueKind int
+
+const (
+	KindNull ValueKind = iota
+	KindString
+	KindBool
+	KindNumber
+	KindBinData
+	KindFunction
+	KindRegex
+	KindArray
+	KindDocument
+	// KindRaw is the text of a value that could not be parsed, in StringValue. Only the lenient
+	// mode produces these.
+	KindRaw
+)
+
+var valueKindNames = []string{
+	"null", "string", "bool", "number", "bindata", "function", "regex", "array", "document", "raw",
+}
+
+func (k ValueKind) String() string {
+	if k >= 0 && int(k) < len(valueKindNames) {
+		return valueKindNames[k]
+	}
+	return fmt.Sprintf("ValueKind(%d)", int(k))
+}
+
 type Value struct {
-	StringValue  string         `( (@String|"null")`
-	BoolValue    bool           `| (@"true" | "false")`
-	NumericValue float64        `| @(["-"] (Float|Int))`
+	// Scalars are captured as raw tokens into StringValue and resolved into Kind, BoolValue and
+	// NumericValue after parsing. Otherwise there would be no telling "", null, false and 0 apart.
+	StringValue  string         `( @(String | "null" | "true" | "false" | ["-"] (Float | Int))`
+	BinDataValue *BinDataValue  `| @BinData`
 	FuncValue    *FunctionValue `| @@`
+	RegexValue   *RegexValue    `| @Regex`
 	ArrayValue   []*Value       `| "[" { @@ { "," @@ } } "]"`
 	Nested       *PseudoJson    `| @@ )`
-	// TODO: There's also a regexvalue :( { blah: /^.*/i }
+
+	Kind         ValueKind
+	BoolValue    bool
+	NumericValue float64
+	// Double is set for the numbers that were logged as floats, ie. 1.0 or 5.5e1
+	Double bool
+}
+
+// RegexValue is a regex literal such as /^foo.*/i
+type RegexValue struct {
+	Pattern string
+	Flags   string
+}
+
+// Capture splits the regex literal into the pattern and flags
+func (r *RegexValue) Capture(values []string) error {
+	literal := strings.Join(values, "")
+	end := strings.LastIndex(literal, "/")
+	r.Pattern = literal[1:end]
+	r.Flags = literal[end+1:]
+	return nil
+}
+
+// BinDataValue is the decoded BinData(subtype, payload). Mongo logs the payload as unquoted hex,
+// the shell uses quoted base64. We go by that, but fall back to the other encoding if needed.
+type BinDataValue struct {
+	Subtype byte
+	Data    []byte
+}
+
+// Capture decodes the subtype and payload of the BinData literal
+func (b *BinDataValue) Capture(values []string) error {
+	literal := strings.Join(values, "")
+	match := binDataLiteralRegex.FindStringSubmatch(literal)
+	if match == nil {
+		return fmt.Errorf("invalid BinData: %v", literal)
+	}
+
+	subtype, err := strconv.ParseUint(match[1], 10, 8)
+	if err != nil {
+		return fmt.Errorf("invalid BinData subtype: %v", literal)
+	}
+	b.Subtype = byte(subtype)
+
+	payload := match[2]
+	decoders := []func(string) ([]byte, error){hex.DecodeString, base64.StdEncoding.DecodeString}
+	if strings.HasPrefix(payload, `"`) || strings.HasPrefix(payload, `'`) {
+		payload = payload[1 : len(payload)-1]
+		decoders[0], decoders[1] = decoders[1], decoders[0]
+	}
+
+	for _, decode := range decoders {
+		if b.Data, err = decode(payload); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid BinData payload: %v", literal)
 }
 
 type FunctionValue struct {
@@ -48,42 +211,141 @@ type FunctionValue struct {
 	FuncArgs []*Value `"(" { @@ ({ "," @@ }) } ")"`
 }
 
+// MongoLogParser is either a participle parser or, for the PseudoJson, the hand-written one
 type MongoLogParser struct {
-	p *participle.Parser
+	p    *participle.Parser
+	fast bool
 }
 
-func mapElementKeys(mongoJson *PseudoJson) {
+func mapElementKeys(mongoJson *PseudoJson) (err error) {
 	mongoJson.elems = make(ElementMap)
+	mongoJson.duplicates = nil
 	for _, e := range mongoJson.Elements {
-		mongoJson.elems[e.Key] = e.Val
-		if e.Val.Nested != nil {
-			mapElementKeys(e.Val.Nested)
+		mongoJson.mapElement(e.Key, e.Val)
+		if err = resolveValue(e.Val); err != nil {
+			return fmt.Errorf("%v: %v", e.Key, err)
+		}
+	}
+	return
+}
+
+func (mongoJson *PseudoJson) mapElement(key string, v *Value) {
+	if _, ok := mongoJson.elems[key]; !ok {
+		mongoJson.elems[key] = v
+		return
+	}
+	for _, dup := range mongoJson.duplicates {
+		if dup == key {
+			return
+		}
+	}
+	mongoJson.duplicates = append(mongoJson.duplicates, key)
+}
+
+// resolveValue fills in the Kind and turns the raw scalar tokens into typed values
+func resolveValue(v *Value) (err error) {
+	switch {
+	case v.BinDataValue != nil:
+		v.Kind = KindBinData
+	case v.FuncValue != nil:
+		v.Kind = KindFunction
+		for _, arg := range v.FuncValue.FuncArgs {
+			if err = resolveValue(arg); err != nil {
+				return
+			}
+		}
+	case v.RegexValue != nil:
+		v.Kind = KindRegex
+	case v.Nested != nil:
+		v.Kind = KindDocument
+		err = mapElementKeys(v.Nested)
+	case v.StringValue == "":
+		// The array is the only alternative that can match without capturing anything
+		v.Kind = KindArray
+		for _, elem := range v.ArrayValue {
+			if err = resolveValue(elem); err != nil {
+				return
+			}
+		}
+	default:
+		err = resolveScalar(v)
+	}
+	return
+}
+
+func resolveScalar(v *Value) (err error) {
+	raw := v.StringValue
+	v.StringValue = ""
+
+	switch raw[0] {
+	case '"', '\'':
+		v.Kind = KindString
+		v.StringValue, err = unquote(raw)
+		return
+	}
+
+	switch raw {
+	case "null":
+		v.Kind = KindNull
+	case "true", "false":
+		v.Kind = KindBool
+		v.BoolValue = raw == "true"
+	default:
+		v.Kind = KindNumber
+		v.Double = strings.ContainsAny(raw, ".eE")
+		v.NumericValue, err = strconv.ParseFloat(raw, 64)
+	}
+	return
+}
+
+// unquote handles both the double and single quoted strings
+func unquote(s string) (string, error) {
+	quote := s[0]
+	s = s[1 : len(s)-1]
+	var out strings.Builder
+	for s != "" {
+		value, _, tail, err := strconv.UnquoteChar(s, quote)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %q: %v", s, err)
 		}
+		out.WriteRune(value)
+		s = tail
 	}
+	return out.String(), nil
 }
 
 func NewPseudoJsonParser() (parser MongoLogParser, err error) {
 	parser = MongoLogParser{}
-	parser.p, err = participle.Build(&PseudoJson{})
+	parser.p, err = participle.Build(&PseudoJson{}, participle.Lexer(pseudoJsonLexer))
 	return
 }
 
+// NewFastPseudoJsonParser returns a hand-written PseudoJson parser. It accepts the same input and
+// produces the same result as NewPseudoJsonParser, only much faster. It can't parse plan summaries.
+func NewFastPseudoJsonParser() (parser MongoLogParser, err error) {
+	return MongoLogParser{fast: true}, nil
+}
+
 func NewCommandParametersParser() (parser MongoLogParser, err error) {
 	return NewPseudoJsonParser()
 }
 
 func NewPlanSummaryParser() (parser MongoLogParser, err error) {
 	parser = MongoLogParser{}
-	parser.p, err = participle.Build(&PlanSummary{})
+	parser.p, err = participle.Build(&PlanSummary{}, participle.Lexer(pseudoJsonLexer))
 	return
 }
 
 func ParsePseudoJson(parser MongoLogParser, message string) (result *PseudoJson, err error) {
+	if parser.fast {
+		return parseFastPseudoJson(message)
+	}
+
 	result = &PseudoJson{}
-	err = parser.p.ParseString(message, result)
-	if err == nil {
-		mapElementKeys(result)
+	if err = parser.p.ParseString(message, result); err != nil {
+		return result, asParseError(message, err)
 	}
+	err = mapElementKeys(result)
 
 	return
 }
@@ -92,8 +354,37 @@ func ParseCommandParameters(parser MongoLogParser, message string) (result *Pseu
 	return ParsePseudoJson(parser, message)
 }
 
+// ParsePlanSummary parses the plan summary. Anything that follows the plan, such as the execution
+// stats, is ignored.
 func ParsePlanSummary(parser MongoLogParser, message string) (result *PlanSummary, err error) {
+	if parser.p == nil {
+		return nil, fmt.Errorf("not a plan summary parser")
+	}
+
 	result = &PlanSummary{}
-	err = parser.p.ParseString(message, result)
+	err = parser.p.ParseString(message, result, participle.AllowTrailing(true))
+	if err != nil {
+		return result, asParseError(message, err)
+	}
+
+	for _, item := range result.Items {
+		for _, key := range item.KeyPattern {
+			if err = resolveValue(key.Value); err != nil {
+				return result, fmt.Errorf("%v: %v", key.Field, err)
+			}
+
+			switch key.Value.Kind {
+			case KindNumber:
+				key.Direction = 1
+				if key.Value.NumericValue < 0 {
+					key.Direction = -1
+				}
+			case KindString:
+				key.Type = key.Value.StringValue
+			default:
+				return result, fmt.Errorf("%v: unexpected index key %v", key.Field, key.Value.Kind)
+			}
+		}
+	}
 	return
 }
@@ -1,13 +1,14 @@
 package mongolog
 
 import (
+	"encoding/hex"
 	"regexp"
 	"testing"
 )
 
 func TestParseCommandParameters(t *testing.T) {
 	parser, _ := NewPseudoJsonParser()
-	testMessage := ReplaceBinData(`{
+	testMessage := `{
 		count.x: "mycatpicscollection",
 		query: {
 			MyObjectId: ObjectId('5a2fc7bd9b45c7117bee26c5'),
@@ -24,7 +25,7 @@ func TestParseCommandParameters(t *testing.T) {
 			mode: "secondaryPreferred"
 		},
 		$db: "FooDb"
-	}`)
+	}`
 
 	msg, err := ParseCommandParameters(parser, testMessage)
 	if err != nil {
@@ -61,6 +62,10 @@ func TestParseCommandParameters(t *testing.T) {
 	if bazMaxTime != 1523022862.698 {
 		t.Errorf("baz.max_time mismatch, got %v", bazMaxTime)
 	}
+	binData := q.elems["x"].BinDataValue
+	if binData == nil || binData.Subtype != 0 || hex.EncodeToString(binData.Data) != "e232321232" {
+		t.Errorf("x BinData mismatch, got %+v", binData)
+	}
 	fooLimit := q.elems["fooLimit"].NumericValue
 	if fooLimit != 42 {
 		t.Errorf("fooLimit mismatch, got %v", fooLimit)
@@ -122,9 +127,51 @@ func TestParseAdHocComplexThing2(t *testing.T) {
 	}
 
 	testMessage := `COLLSCAN keysExamined:0 docsExamined:45227 cursorExhausted:1 numYields:353 nreturned:0 reslen:140 locks:{ Global: { acquireCount: { r: 354 } }, Database: { acquireCount: { r: 354 } }, Collection: { acquireCount: { r: 354 } } }`
-	_, err = ParsePlanSummary(parser, testMessage)
+	plan, err := ParsePlanSummary(parser, testMessage)
 	if err != nil {
 		t.Errorf("parse error: %v: %v\n", testMessage, err)
+		return
+	}
+
+	// The stats must not be mixed into the plan
+	if len(plan.Items) != 1 || plan.Items[0].PlanType != "COLLSCAN" || plan.Items[0].KeyPattern != nil {
+		t.Errorf("unexpected plan: %v", plan)
+	}
+}
+
+func TestParsePlanSummaryStages(t *testing.T) {
+	parser, _ := NewPlanSummaryParser()
+
+	testMessages := map[string]string{
+		`IXSCAN { b: 1, a: -1 } keysExamined:1`:         `IXSCAN { b: 1, a: -1 }`,
+		`IXSCAN { a: 1 }, IXSCAN { b: 1, c: 1 }`:        `IXSCAN { a: 1 }, IXSCAN { b: 1, c: 1 }`,
+		`COUNT_SCAN { foo.bar: 1 }`:                     `COUNT_SCAN { foo.bar: 1 }`,
+		`IXSCAN { _fts: "text", _ftsx: 1 }`:             `IXSCAN { _fts: "text", _ftsx: 1 }`,
+		`IXSCAN { loc: "2dsphere" }, IXSCAN { $**: 1 }`: `IXSCAN { loc: "2dsphere" }, IXSCAN { $**: 1 }`,
+		`IDHACK`: `IDHACK`,
+		`EOF`:    `EOF`,
+		`SORT_KEY_GENERATOR cursorid:12345 keysExamined:0 0ms`: `SORT_KEY_GENERATOR`,
+	}
+
+	for message, expect := range testMessages {
+		plan, err := ParsePlanSummary(parser, message)
+		if err != nil {
+			t.Errorf("parse error: %v: %v\n", message, err)
+			continue
+		}
+		if plan.String() != expect {
+			t.Errorf("expected %v, got %v", expect, plan)
+		}
+	}
+
+	plan, _ := ParsePlanSummary(parser, `IXSCAN { b: 1, a: -1 }, COLLSCAN`)
+	keys := plan.Items[0].KeyPattern
+	if len(keys) != 2 || keys[0].Field != "b" || keys[0].Direction != 1 ||
+		keys[1].Field != "a" || keys[1].Direction != -1 {
+		t.Errorf("unexpected key pattern: %v", plan)
+	}
+	if !plan.HasStage("COLLSCAN") || plan.HasStage("IDHACK") {
+		t.Errorf("unexpected stages: %v", plan)
 	}
 }
 
@@ -206,6 +253,67 @@ func TestParseCommandParametersMixedModeEdges(t *testing.T) {
 	}
 }
 
+func TestParseRegexValues(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	testMessage := `{ name: /^foo.*/i, path: /a\/b/, filter: { $in: [ /^x/, /y$/m ] } }`
+
+	msg, err := ParseCommandParameters(parser, testMessage)
+	if err != nil {
+		t.Errorf("unable to parse message: %v: %v\n", testMessage, err)
+		return
+	}
+
+	name := msg.elems["name"].RegexValue
+	if name == nil || name.Pattern != "^foo.*" || name.Flags != "i" {
+		t.Errorf("name regex mismatch, got %+v", name)
+	}
+
+	path := msg.elems["path"].RegexValue
+	if path == nil || path.Pattern != `a\/b` || path.Flags != "" {
+		t.Errorf("path regex mismatch, got %+v", path)
+	}
+
+	in := msg.elems["filter"].Nested.elems["$in"].ArrayValue
+	if len(in) != 2 || in[1].RegexValue.Pattern != "y$" || in[1].RegexValue.Flags != "m" {
+		t.Errorf("$in regex mismatch")
+	}
+}
+
+func TestParseBinDataValues(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	testMessage := `{ a: BinData(0, E3B0C44298FC1C), b: BinData(4, 8c5f0e3b9a4a4f6e9d2b0c1e6f7a8b9c),` +
+		` c: BinData(3, "jF8OO5pKT26dKwweb3qLnA=="), d: BinData(6, 'AQID'), e: BinData(0, ) }`
+
+	msg, err := ParseCommandParameters(parser, testMessage)
+	if err != nil {
+		t.Errorf("unable to parse message: %v: %v\n", testMessage, err)
+		return
+	}
+
+	expectValues := []struct {
+		key     string
+		subtype byte
+		data    string
+	}{
+		{"a", 0, "e3b0c44298fc1c"},
+		{"b", 4, "8c5f0e3b9a4a4f6e9d2b0c1e6f7a8b9c"},
+		{"c", 3, "8c5f0e3b9a4a4f6e9d2b0c1e6f7a8b9c"},
+		{"d", 6, "010203"},
+		{"e", 0, ""},
+	}
+	for _, v := range expectValues {
+		binData := msg.elems[v.key].BinDataValue
+		if binData == nil {
+			t.Errorf("%v: expected BinData", v.key)
+			continue
+		}
+		if binData.Subtype != v.subtype || hex.EncodeToString(binData.Data) != v.data {
+			t.Errorf("%v: expected subtype %v data %v, got %v %x", v.key, v.subtype, v.data,
+				binData.Subtype, binData.Data)
+		}
+	}
+}
+
 func TestForParseErrors(t *testing.T) {
 	testMessages := []string{
 		`{ kala: "maja" }`,
@@ -221,6 +329,7 @@ func TestForParseErrors(t *testing.T) {
 		`{ find: "mycatpicscollection", filter: { foo.FooObjectId: ObjectId('5a8c3a142053a407a936745e'),
 		   foo.max_time: { $gte: 1534769530.5 }, foo.min_time: { $lte: 1534769548.47 },
 		   foo.category: { $in: [ "alley", "home" ] } }, $db: "FooDb" }`,
+		`{ find: "mycatpicscollection", filter: { name: /^Garfield/ }, $db: "FooDb" }`,
 		// And this is interesting because it contains all sorts of shit that is outside
 		// of curly braces. Should we attempt to support this or parse out with regex?
 		`{ foo.FooObjectId: 1, foo.category: 1, foo.min_time: -1, foo.max_time: 1 }
@@ -240,12 +349,22 @@ func TestForParseErrors(t *testing.T) {
 	}
 }
 
-func benchmarkParseCommandParameters(testMessage string, b *testing.B) {
-	parser, err := NewPseudoJsonParser()
+const (
+	benchmarkMessageSmall  = `{ a: 1 }`
+	benchmarkMessageMedium = `{ driver: { name: "PyMongo", version: "3.4.0" }, os: { type: "Linux" } }`
+	benchmarkMessageLarge  = `{ 
+	  count: "mycatpicscollection", query: { MyObjectId: ObjectId('5a2fc7bd9b45c7117bee26c5'),
+	  baz.max_time: { $gte: 1523022862.698 }, baz.min_time: { $lte: 1523022882.698 },
+	  baz.category: "catinabag" }, $readPreference: { mode: "secondaryPreferred" }, $db: "FooDb"}`
+)
+
+func benchmarkParseCommandParameters(newParser func() (MongoLogParser, error), testMessage string, b *testing.B) {
+	parser, err := newParser()
 	if err != nil {
 		b.Errorf("Error initializing parser: %v\n", err)
 	}
 
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		if _, err := ParseCommandParameters(parser, testMessage); err != nil {
 			b.Errorf("Cannot parse: %v\n", testMessage)
@@ -254,18 +373,27 @@ func benchmarkParseCommandParameters(testMessage string, b *testing.B) {
 }
 
 func BenchmarkParseCommandParametersSmall(b *testing.B) {
-	benchmarkParseCommandParameters(`{ a: 1 }`, b)
+	benchmarkParseCommandParameters(NewPseudoJsonParser, benchmarkMessageSmall, b)
 }
 
 func BenchmarkParseCommandParametersMedium(b *testing.B) {
-	benchmarkParseCommandParameters(`{ driver: { name: "PyMongo", version: "3.4.0" }, os: { type: "Linux" } }`, b)
+	benchmarkParseCommandParameters(NewPseudoJsonParser, benchmarkMessageMedium, b)
 }
 
 func BenchmarkParseCommandParametersLarge(b *testing.B) {
-	benchmarkParseCommandParameters(`{ 
-	  count: "mycatpicscollection", query: { MyObjectId: ObjectId('5a2fc7bd9b45c7117bee26c5'),
-	  baz.max_time: { $gte: 1523022862.698 }, baz.min_time: { $lte: 1523022882.698 },
-	  baz.category: "catinabag" }, $readPreference: { mode: "secondaryPreferred" }, $db: "FooDb"}`, b)
+	benchmarkParseCommandParameters(NewPseudoJsonParser, benchmarkMessageLarge, b)
+}
+
+func BenchmarkFastParseCommandParametersSmall(b *testing.B) {
+	benchmarkParseCommandParameters(NewFastPseudoJsonParser, benchmarkMessageSmall, b)
+}
+
+func BenchmarkFastParseCommandParametersMedium(b *testing.B) {
+	benchmarkParseCommandParameters(NewFastPseudoJsonParser, benchmarkMessageMedium, b)
+}
+
+func BenchmarkFastParseCommandParametersLarge(b *testing.B) {
+	benchmarkParseCommandParameters(NewFastPseudoJsonParser, benchmarkMessageLarge, b)
 }
 
 // Compare against a regex based parser
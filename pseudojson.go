@@ -0,0 +1,200 @@
+package mongolog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Get looks up a value by a dotted path such as "filter.$and.0.x". Array elements are addressed
+// by index. Mongo keys can contain dots themselves (foo.FooObjectId), so the longest literal key
+// that matches a path prefix is tried first. If a key is duplicated, the first value is used.
+// Returns nil if nothing is found.
+func (doc *PseudoJson) Get(path string) *Value {
+	if doc == nil {
+		return nil
+	}
+	return lookupDocument(doc, strings.Split(path, "."))
+}
+
+// Get looks up a value by a dotted path relative to this value. See PseudoJson.Get.
+func (v *Value) Get(path string) *Value {
+	if v == nil {
+		return nil
+	}
+	if path == "" {
+		return v
+	}
+	return lookupValue(v, strings.Split(path, "."))
+}
+
+// Has reports whether a value exists at the path
+func (doc *PseudoJson) Has(path string) bool {
+	return doc.Get(path) != nil
+}
+
+// GetString returns the string at the path, ok is false if it's missing or not a string
+func (doc *PseudoJson) GetString(path string) (result string, ok bool) {
+	if v := doc.Get(path); v != nil && v.Kind == KindString {
+		return v.StringValue, true
+	}
+	return
+}
+
+// GetNumber returns the number at the path, ok is false if it's missing or not a number
+func (doc *PseudoJson) GetNumber(path string) (result float64, ok bool) {
+	if v := doc.Get(path); v != nil && v.Kind == KindNumber {
+		return v.NumericValue, true
+	}
+	return
+}
+
+// GetBool returns the boolean at the path, ok is false if it's missing or not a boolean
+func (doc *PseudoJson) GetBool(path string) (result bool, ok bool) {
+	if v := doc.Get(path); v != nil && v.Kind == KindBool {
+		return v.BoolValue, true
+	}
+	return
+}
+
+// GetDocument returns the nested document at the path or nil
+func (doc *PseudoJson) GetDocument(path string) *PseudoJson {
+	if v := doc.Get(path); v != nil && v.Kind == KindDocument {
+		return v.Nested
+	}
+	return nil
+}
+
+// Keys returns the top level keys of the document in the order they were logged
+func (doc *PseudoJson) Keys() (keys []string) {
+	if doc == nil {
+		return
+	}
+	for _, e := range doc.Elements {
+		keys = append(keys, e.Key)
+	}
+	return
+}
+
+// Range calls fn for every element of the document in order, duplicate keys included. The
+// iteration stops when fn returns false.
+func (doc *PseudoJson) Range(fn func(key string, v *Value) bool) {
+	if doc == nil {
+		return
+	}
+	for _, e := range doc.Elements {
+		if !fn(e.Key, e.Val) {
+			return
+		}
+	}
+}
+
+// Values returns all the values of a top level key in order. Usually there's just one, but
+// nothing stops Mongo from logging a document with duplicate keys.
+func (doc *PseudoJson) Values(key string) (values []*Value) {
+	doc.Range(func(k string, v *Value) bool {
+		if k == key {
+			values = append(values, v)
+		}
+		return true
+	})
+	return
+}
+
+// Duplicates returns the top level keys that occur more than once, in order of appearance
+func (doc *PseudoJson) Duplicates() []string {
+	if doc == nil {
+		return nil
+	}
+	if doc.elems != nil {
+		return doc.duplicates
+	}
+
+	var duplicates []string
+	seen := make(map[string]int)
+	for _, e := range doc.Elements {
+		seen[e.Key]++
+		if seen[e.Key] == 2 {
+			duplicates = append(duplicates, e.Key)
+		}
+	}
+	return duplicates
+}
+
+// HasDuplicates reports whether the document or any of its subdocuments has duplicate keys
+func (doc *PseudoJson) HasDuplicates() bool {
+	if len(doc.Duplicates()) > 0 {
+		return true
+	}
+	found := false
+	doc.Range(func(_ string, v *Value) bool {
+		found = v.hasDuplicates()
+		return !found
+	})
+	return found
+}
+
+func (v *Value) hasDuplicates() bool {
+	switch v.Kind {
+	case KindDocument:
+		return v.Nested.HasDuplicates()
+	case KindArray:
+		for _, elem := range v.ArrayValue {
+			if elem.hasDuplicates() {
+				return true
+			}
+		}
+	case KindFunction:
+		for _, arg := range v.FuncValue.FuncArgs {
+			if arg.hasDuplicates() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (doc *PseudoJson) element(key string) (*Value, bool) {
+	if doc.elems != nil {
+		v, ok := doc.elems[key]
+		return v, ok
+	}
+
+	// Not built by the parser, fall back to a linear scan
+	for _, e := range doc.Elements {
+		if e.Key == key {
+			return e.Val, true
+		}
+	}
+	return nil, false
+}
+
+func lookupDocument(doc *PseudoJson, parts []string) *Value {
+	for n := len(parts); n > 0; n-- {
+		v, ok := doc.element(strings.Join(parts[:n], "."))
+		if !ok {
+			continue
+		}
+		if result := lookupValue(v, parts[n:]); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
+func lookupValue(v *Value, parts []string) *Value {
+	if len(parts) == 0 {
+		return v
+	}
+
+	switch v.Kind {
+	case KindDocument:
+		return lookupDocument(v.Nested, parts)
+	case KindArray:
+		pos, err := strconv.Atoi(parts[0])
+		if err != nil || pos < 0 || pos >= len(v.ArrayValue) {
+			return nil
+		}
+		return lookupValue(v.ArrayValue[pos], parts[1:])
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package mongolog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPseudoJsonGet(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	testMessage := `{ find: "mycatpicscollection", filter: { foo.FooObjectId: ObjectId('5a8c3a142053a407a936745e'),` +
+		` foo.category: { $in: [ "alley", "home" ] }, $and: [ { x: 1 }, { y: { z: true } } ] },` +
+		` limit: 0, singleBatch: false, comment: "", hint: null, $db: "FooDb" }`
+
+	msg, err := ParseCommandParameters(parser, testMessage)
+	if err != nil {
+		t.Errorf("unable to parse message: %v: %v\n", testMessage, err)
+		return
+	}
+
+	if s, ok := msg.GetString("find"); !ok || s != "mycatpicscollection" {
+		t.Errorf("find mismatch, got %v %v", s, ok)
+	}
+	if s, ok := msg.GetString("filter.foo.category.$in.1"); !ok || s != "home" {
+		t.Errorf("filter.foo.category.$in.1 mismatch, got %v %v", s, ok)
+	}
+	if n, ok := msg.GetNumber("filter.$and.0.x"); !ok || n != 1 {
+		t.Errorf("filter.$and.0.x mismatch, got %v %v", n, ok)
+	}
+	if b, ok := msg.GetBool("filter.$and.1.y.z"); !ok || !b {
+		t.Errorf("filter.$and.1.y.z mismatch, got %v %v", b, ok)
+	}
+	if v := msg.Get("filter.foo.FooObjectId"); v == nil || v.Kind != KindFunction {
+		t.Errorf("filter.foo.FooObjectId mismatch, got %+v", v)
+	}
+
+	// Zero values must still be told apart
+	if n, ok := msg.GetNumber("limit"); !ok || n != 0 {
+		t.Errorf("limit mismatch, got %v %v", n, ok)
+	}
+	if b, ok := msg.GetBool("singleBatch"); !ok || b {
+		t.Errorf("singleBatch mismatch, got %v %v", b, ok)
+	}
+	if s, ok := msg.GetString("comment"); !ok || s != "" {
+		t.Errorf("comment mismatch, got %v %v", s, ok)
+	}
+	if v := msg.Get("hint"); v == nil || v.Kind != KindNull {
+		t.Errorf("hint mismatch, got %+v", v)
+	}
+	if _, ok := msg.GetString("hint"); ok {
+		t.Errorf("null should not be a string")
+	}
+
+	for _, path := range []string{"nope", "filter.nope", "filter.$and.2", "filter.$and.x", "find.x"} {
+		if msg.Has(path) {
+			t.Errorf("unexpected value at %v", path)
+		}
+	}
+
+	expectKeys := []string{"find", "filter", "limit", "singleBatch", "comment", "hint", "$db"}
+	if keys := msg.Keys(); !reflect.DeepEqual(keys, expectKeys) {
+		t.Errorf("keys mismatch, got %v", keys)
+	}
+}
+
+func TestValueKinds(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	testMessage := `{ a: null, b: "x", c: true, d: -1.5, e: BinData(0, 00), f: new Date(0), g: /x/,` +
+		` h: [], i: {} }`
+
+	msg, err := ParseCommandParameters(parser, testMessage)
+	if err != nil {
+		t.Errorf("unable to parse message: %v: %v\n", testMessage, err)
+		return
+	}
+
+	expectKinds := map[string]ValueKind{
+		"a": KindNull, "b": KindString, "c": KindBool, "d": KindNumber, "e": KindBinData,
+		"f": KindFunction, "g": KindRegex, "h": KindArray, "i": KindDocument,
+	}
+	for k, v := range expectKinds {
+		if kind := msg.Get(k).Kind; kind != v {
+			t.Errorf("%v: expected %v, got %v", k, v, kind)
+		}
+	}
+}
+
+func TestPseudoJsonOrderAndDuplicates(t *testing.T) {
+	parser, _ := NewPseudoJsonParser()
+	testMessage := `{ sort: { b: 1, a: -1, c: 1 }, x: 1, y: 2, x: 3, filter: { z: 1, z: 2 } }`
+
+	msg, err := ParseCommandParameters(parser, testMessage)
+	if err != nil {
+		t.Errorf("unable to parse message: %v: %v\n", testMessage, err)
+		return
+	}
+
+	var sortKeys []string
+	msg.GetDocument("sort").Range(func(key string, v *Value) bool {
+		sortKeys = append(sortKeys, key)
+		return true
+	})
+	if !reflect.DeepEqual(sortKeys, []string{"b", "a", "c"}) {
+		t.Errorf("unexpected sort order: %v", sortKeys)
+	}
+
+	if n, _ := msg.GetNumber("x"); n != 1 {
+		t.Errorf("expected the first x to win, got %v", n)
+	}
+	values := msg.Values("x")
+	if len(values) != 2 || values[0].NumericValue != 1 || values[1].NumericValue != 3 {
+		t.Errorf("unexpected values for x: %v", values)
+	}
+
+	if dups := msg.Duplicates(); !reflect.DeepEqual(dups, []string{"x"}) {
+		t.Errorf("unexpected duplicates: %v", dups)
+	}
+	if !msg.HasDuplicates() || msg.GetDocument("sort").HasDuplicates() {
+		t.Errorf("duplicates not reported correctly")
+	}
+	if !msg.GetDocument("filter").HasDuplicates() {
+		t.Errorf("expected filter to have duplicates")
+	}
+
+	expectJson := `{"sort":{"b":1,"a":-1,"c":1},"x":1,"y":2,"x":3,"filter":{"z":1,"z":2}}`
+	if s, _ := msg.ToExtendedJSON(false); string(s) != expectJson {
+		t.Errorf("unexpected extended JSON: %s", s)
+	}
+}
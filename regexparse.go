@@ -2,12 +2,13 @@ package mongolog
 
 import (
 	"regexp"
+	"strings"
 )
 
 var (
 	MongoLoglineRegex = regexp.MustCompile(
-		`(?P<timestamp>[^\s]+)\s` +
-			`(?P<severity>.)\s` +
+		`^(?P<timestamp>[A-Z][a-z]{2} [A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}(?:\.\d+)?|[^\s]+)\s` +
+			`(?P<severity>[FEWI]|D[1-5]?)\s` +
 			`(?P<component>[^\s]+)\s+` +
 			`(?P<context>[^\s]+)\s` +
 			`(?P<message>.*)`)
@@ -16,15 +17,20 @@ var (
 		`command (?P<collection>[^\s]+)\scommand:\s` +
 			`(?P<command>[^\s]+)\s`)
 
+	// Not every command has a planSummary, ie. aggregate with just $indexStats
+	//
+	// Deprecated: the parser finds the documents with ExtractDocument, the lazy match stops at the
+	// first closing brace of the command parameters.
 	MongoLogCommandPayloadRegex = regexp.MustCompile(
 		`command (?P<collection>[^\s]+)\scommand:\s` +
 			`(?P<command>[^\s]+)\s` +
-			`(?P<commandparams>{.*})\s` +
-			`planSummary:\s` +
-			`(?P<plansummary>.*)\sprotocol:` +
+			`(?P<commandparams>{.*?})\s` +
+			`(?:planSummary:\s` +
+			`(?P<plansummary>.*)\s)?protocol:` +
 			`(?P<protocol>[^\s]+)\s` +
 			`(?P<duration>[0-9]+)ms`)
 
+	// Deprecated: the parser finds the documents with ExtractDocument.
 	MongoLogOtherPayloadRegex = regexp.MustCompile(
 		`command (?P<collection>[^\s]+)\scommand:\s` +
 			`(?P<command>[^\s]+)\s` +
@@ -32,6 +38,18 @@ var (
 			`(?P<protocol>[^\s]+)\s` +
 			`(?P<duration>[0-9]+)ms`)
 
+	// query FooDb.mycatpicscollection query: { ... } planSummary: COLLSCAN ntoreturn:0 ...
+	// update FooDb.mycatpicscollection query: { ... } planSummary: IDHACK update: { ... } ...
+	// update FooDb.mycatpicscollection command: { q: { ... }, u: { ... } } planSummary: ...
+	MongoLegacyOperationRegex = regexp.MustCompile(
+		`^(?P<operation>query|getmore|update|remove|insert) (?P<collection>[^\s]+) (?P<payload>.*)`)
+
+	// warning: log line attempted (12kB) over max size (10kB), printing beginning and end ... command ...
+	// The beginning and the end of the message are separated by " .......... "
+	MongoTruncatedLineRegex = regexp.MustCompile(
+		`^warning: log line attempted \((?P<size>\d+)kB\) over max size \((?P<maxsize>\d+)kB\),` +
+			` printing beginning and end \.\.\. `)
+
 	// connection accepted from 10.178.5.250:47878 #2078609 (252 connections now open)
 	MongoNewConnectionRegex = regexp.MustCompile(
 		`connection accepted from (?P<ip>[\d.]+):(?P<port>\d+) #(?P<id>\d+)`)
@@ -41,8 +59,16 @@ var (
 	MongoConnectionMetadataRegex = regexp.MustCompile(
 		`received client metadata from (?P<ip>[\d.]+):(?P<port>\d+) (?P<id>[a-z\d]+): (?P<metadata>.*)`)
 
-	MongoBinDataRegex = regexp.MustCompile(
-		`(BinData\(0,) ([A-F0-9]+)\)`)
+	// keysExamined:50314 docsExamined:2 ... protocol:op_query 219ms
+	MongoExecStatRegex = regexp.MustCompile(
+		`(?:^|\s)(?P<name>[a-zA-Z]+):(?P<value>\d+)\b`)
+	MongoProtocolRegex = regexp.MustCompile(
+		`\sprotocol:(?P<protocol>[^\s]+)`)
+	MongoDurationRegex = regexp.MustCompile(
+		`\s(?P<duration>[0-9]+)ms$`)
+	// locks:{ Global: { acquireCount: { r: 788 } } }, unlike documents there's no space after the colon
+	MongoLocksRegex = regexp.MustCompile(
+		`\slocks:{`)
 )
 
 // Match a regexp against a string. Return the subgroups in a dictionary
@@ -61,7 +87,64 @@ func RegexpMatch(re *regexp.Regexp, matchText string) (results map[string]string
 	return
 }
 
-// This is a hack to make the BinData parseable. Really ought to handle this properly in the parser.
-func ReplaceBinData(message string) string {
-	return MongoBinDataRegex.ReplaceAllString(message, "$1 \"$2\")")
+// ExtractDocument returns the balanced {...} document that starts at the given offset of the
+// message. Braces inside quoted strings are skipped. Returns false if the document is not closed.
+func ExtractDocument(message string, start int) (doc string, ok bool) {
+	if start < 0 || start >= len(message) || message[start] != '{' {
+		return
+	}
+
+	depth := 0
+	var quote byte
+	for i := start; i < len(message); i++ {
+		c := message[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return message[start : i+1], true
+			}
+		}
+	}
+	return
+}
+
+// topLevelIndex returns the index of the key in the message, ie. "update: {", skipping over the
+// documents, arrays and strings so that the keys nested in them are not matched. The key must be
+// at the start of the message or follow a space. Returns -1 if the key is not found.
+func topLevelIndex(message string, key string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && (i == 0 || message[i-1] == ' ') && strings.HasPrefix(message[i:], key):
+			return i
+		}
+	}
+	return -1
 }
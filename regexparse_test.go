@@ -128,12 +128,17 @@ func TestParseOtherCommand(t *testing.T) {
 	checkExpectedValues(t, expectValues, matches)
 }
 
-func TestReplaceBinData(t *testing.T) {
-	message := `{ a: BinData(0, E3B0C44298FC1), b: BinData(0, E3B0C44298FC1) }`
-	expectMessage := `{ a: BinData(0, "E3B0C44298FC1"), b: BinData(0, "E3B0C44298FC1") }`
+func TestExtractDocument(t *testing.T) {
+	message := `query: { a: "}{", b: { c: 1 } } planSummary: COLLSCAN`
+	doc, ok := ExtractDocument(message, strings.Index(message, "{"))
+	if !ok || doc != `{ a: "}{", b: { c: 1 } }` {
+		t.Errorf("unexpected document: %v", doc)
+	}
 
-	s := ReplaceBinData(message)
-	if s != expectMessage {
-		t.Errorf("unexpected result:\nexpect: %v\nvalue : %v\n", expectMessage, s)
+	if _, ok := ExtractDocument(`query: { a: { b: 1 }`, 7); ok {
+		t.Errorf("expected unclosed document to fail")
+	}
+	if _, ok := ExtractDocument(message, 0); ok {
+		t.Errorf("expected to fail when not starting at a brace")
 	}
 }
@@ -0,0 +1,182 @@
+package mongolog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QueryStats are the aggregated execution stats of the queries of the same shape
+type QueryStats struct {
+	Shape        *QueryShape
+	Count        int
+	Total        time.Duration
+	DocsExamined int64
+	KeysExamined int64
+	NReturned    int64
+	// Plans counts the queries by the plan summary, the queries without a plan are left out
+	Plans map[string]int
+
+	durations []time.Duration
+	sorted    bool
+}
+
+// Min returns the shortest duration of the queries
+func (stats *QueryStats) Min() time.Duration {
+	return stats.Percentile(0)
+}
+
+// Max returns the longest duration of the queries
+func (stats *QueryStats) Max() time.Duration {
+	return stats.Percentile(100)
+}
+
+// Mean returns the average duration of the queries
+func (stats *QueryStats) Mean() time.Duration {
+	if stats.Count == 0 {
+		return 0
+	}
+	return stats.Total / time.Duration(stats.Count)
+}
+
+// Percentile returns the duration at the percentile p (0-100), using the nearest rank
+func (stats *QueryStats) Percentile(p float64) time.Duration {
+	if len(stats.durations) == 0 {
+		return 0
+	}
+	if !stats.sorted {
+		sort.Slice(stats.durations, func(i, j int) bool { return stats.durations[i] < stats.durations[j] })
+		stats.sorted = true
+	}
+
+	rank := int(p/100*float64(len(stats.durations))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(stats.durations) {
+		rank = len(stats.durations) - 1
+	}
+	return stats.durations[rank]
+}
+
+// PlanSummaries returns the plans used by the queries, the most used first
+func (stats *QueryStats) PlanSummaries() []string {
+	plans := make([]string, 0, len(stats.Plans))
+	for plan := range stats.Plans {
+		plans = append(plans, plan)
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if stats.Plans[plans[i]] != stats.Plans[plans[j]] {
+			return stats.Plans[plans[i]] > stats.Plans[plans[j]]
+		}
+		return plans[i] < plans[j]
+	})
+	return plans
+}
+
+func (stats *QueryStats) plans() string {
+	return strings.Join(stats.PlanSummaries(), "; ")
+}
+
+func (stats *QueryStats) add(entry *MongoLogEntry) {
+	duration := entry.ExecStats.Duration
+	stats.Count++
+	stats.Total += duration
+	stats.DocsExamined += entry.ExecStats.DocsExamined
+	stats.KeysExamined += entry.ExecStats.KeysExamined
+	stats.NReturned += entry.ExecStats.NReturned
+	stats.durations = append(stats.durations, duration)
+	stats.sorted = false
+
+	if entry.PlanInfo != nil {
+		stats.Plans[entry.PlanInfo.String()]++
+	}
+}
+
+// QueryReport aggregates the slow queries of the log by namespace and query shape. It is not safe
+// for concurrent use.
+type QueryReport struct {
+	queries map[string]*QueryStats
+}
+
+func NewQueryReport() *QueryReport {
+	return &QueryReport{queries: make(map[string]*QueryStats)}
+}
+
+// Add adds the entry to the report. Entries without the execution stats or command parameters
+// are ignored, the return value tells if the entry was added.
+func (report *QueryReport) Add(entry *MongoLogEntry) bool {
+	if entry.ExecStats == nil {
+		return false
+	}
+	shape := NewQueryShape(entry)
+	if shape == nil {
+		return false
+	}
+
+	hash := shape.Hash()
+	stats, ok := report.queries[hash]
+	if !ok {
+		stats = &QueryStats{Shape: shape, Plans: make(map[string]int)}
+		report.queries[hash] = stats
+	}
+	stats.add(entry)
+	return true
+}
+
+// Len returns the number of distinct query shapes in the report
+func (report *QueryReport) Len() int {
+	return len(report.queries)
+}
+
+// The columns that the queries can be sorted by. The namespaces, commands, plans and shapes are
+// sorted in the ascending order, the numbers from the largest. The plans are sorted by the plan
+// summaries, the most used first.
+var queryStatsColumns = map[string]func(a, b *QueryStats) bool{
+	"namespace":    func(a, b *QueryStats) bool { return a.Shape.Namespace < b.Shape.Namespace },
+	"command":      func(a, b *QueryStats) bool { return a.Shape.Command < b.Shape.Command },
+	"plans":        func(a, b *QueryStats) bool { return a.plans() < b.plans() },
+	"shape":        func(a, b *QueryStats) bool { return a.Shape.Pattern() < b.Shape.Pattern() },
+	"count":        func(a, b *QueryStats) bool { return a.Count > b.Count },
+	"total":        func(a, b *QueryStats) bool { return a.Total > b.Total },
+	"min":          func(a, b *QueryStats) bool { return a.Min() > b.Min() },
+	"mean":         func(a, b *QueryStats) bool { return a.Mean() > b.Mean() },
+	"p95":          func(a, b *QueryStats) bool { return a.Percentile(95) > b.Percentile(95) },
+	"max":          func(a, b *QueryStats) bool { return a.Max() > b.Max() },
+	"docsExamined": func(a, b *QueryStats) bool { return a.DocsExamined > b.DocsExamined },
+	"keysExamined": func(a, b *QueryStats) bool { return a.KeysExamined > b.KeysExamined },
+	"nreturned":    func(a, b *QueryStats) bool { return a.NReturned > b.NReturned },
+}
+
+// QueryStatsColumns returns the names of the columns that Queries can sort by
+func QueryStatsColumns() []string {
+	columns := make([]string, 0, len(queryStatsColumns))
+	for name := range queryStatsColumns {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// Queries returns the aggregated queries sorted by the column, see QueryStatsColumns. The ties
+// are sorted by the namespace and shape.
+func (report *QueryReport) Queries(column string) ([]*QueryStats, error) {
+	less, ok := queryStatsColumns[column]
+	if !ok {
+		return nil, fmt.Errorf("unknown column %q, expected one of: %v", column,
+			strings.Join(QueryStatsColumns(), ", "))
+	}
+
+	queries := make([]*QueryStats, 0, len(report.queries))
+	for _, stats := range report.queries {
+		queries = append(queries, stats)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		a, b := queries[i], queries[j]
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.Shape.String() < b.Shape.String()
+	})
+	return queries, nil
+}
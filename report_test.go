@@ -0,0 +1,95 @@
+package mongolog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueryReport(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.%v command: find` +
+		` { find: "%v", filter: %v } planSummary: %v keysExamined:%d docsExamined:%d numYields:0` +
+		` nreturned:%d reslen:100 protocol:op_msg %dms`
+
+	report := NewQueryReport()
+	parser, _ := NewLogParser()
+	add := func(collection, filter, plan string, keys, docs, nreturned, millis int) {
+		m, err := parser.Parse(fmt.Sprintf(logLine, collection, collection, filter, plan, keys, docs,
+			nreturned, millis))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !report.Add(&m) {
+			t.Fatalf("entry not added: %v", m.LogMessage)
+		}
+	}
+
+	for i := 1; i <= 20; i++ {
+		add("cats", fmt.Sprintf("{ a: %d }", i), "IXSCAN { a: 1 }", 1, 1, 1, i*10)
+	}
+	add("cats", "{ a: 0 }", "COLLSCAN", 0, 100, 1, 500)
+	add("cats", `{ a: 1, b: "x" }`, "COLLSCAN", 0, 100, 0, 300)
+	add("dogs", "{ a: 1 }", "COLLSCAN", 0, 1000, 5, 1000)
+
+	if report.Len() != 3 {
+		t.Fatalf("expected 3 shapes, got %v", report.Len())
+	}
+	if report.Add(&MongoLogEntry{}) {
+		t.Errorf("an entry without stats should not be added")
+	}
+
+	queries, err := report.Queries("count")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cats := queries[0]
+	if cats.Shape.Namespace != "FooDb.cats" || cats.Shape.Filter != "{ a: ? }" || cats.Count != 21 {
+		t.Fatalf("unexpected first query: %v %v", cats.Shape, cats.Count)
+	}
+	expect := []struct {
+		name   string
+		value  time.Duration
+		expect time.Duration
+	}{
+		{"min", cats.Min(), 10 * time.Millisecond},
+		{"max", cats.Max(), 500 * time.Millisecond},
+		{"p95", cats.Percentile(95), 200 * time.Millisecond},
+		{"mean", cats.Mean(), 2600 * time.Millisecond / 21},
+		{"total", cats.Total, 2600 * time.Millisecond},
+	}
+	for _, v := range expect {
+		if v.value != v.expect {
+			t.Errorf("%v: expected %v, got %v", v.name, v.expect, v.value)
+		}
+	}
+	if cats.DocsExamined != 120 || cats.KeysExamined != 20 || cats.NReturned != 21 {
+		t.Errorf("unexpected totals: %+v", cats)
+	}
+	if plans := cats.PlanSummaries(); len(plans) != 2 || plans[0] != "IXSCAN { a: 1 }" || plans[1] != "COLLSCAN" {
+		t.Errorf("unexpected plans: %v", plans)
+	}
+
+	for column, first := range map[string]string{
+		"max":          "find FooDb.dogs filter: { a: ? }",
+		"docsExamined": "find FooDb.dogs filter: { a: ? }",
+		"total":        "find FooDb.cats filter: { a: ? }",
+		"mean":         "find FooDb.dogs filter: { a: ? }",
+		"nreturned":    "find FooDb.cats filter: { a: ? }",
+		"namespace":    "find FooDb.cats filter: { a: ? }",
+		"plans":        "find FooDb.cats filter: { a: ?, b: ? }",
+		"shape":        "find FooDb.cats filter: { a: ? }",
+	} {
+		queries, err := report.Queries(column)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", column, err)
+			continue
+		}
+		if queries[0].Shape.String() != first {
+			t.Errorf("%v: unexpected first query %v", column, queries[0].Shape)
+		}
+	}
+
+	if _, err := report.Queries("foo"); err == nil {
+		t.Errorf("expected an error for an unknown column")
+	}
+}
@@ -0,0 +1,284 @@
+package mongolog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Finding is a problem found by a rule in a log entry
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	Entry    *MongoLogEntry
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%v %v: %v: %v", f.Severity, f.Rule, f.Entry.Namespace, f.Message)
+}
+
+// RuleConfig configures a rule of the RuleEngine. Type is one of RuleTypes, the Name defaults to
+// it. The severity defaults to W and the threshold to the default of the rule type.
+type RuleConfig struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Severity  Severity `json:"severity"`
+	Threshold *float64 `json:"threshold"`
+	Disabled  bool     `json:"disabled"`
+}
+
+// RulesConfig is the rule engine configuration, ie.
+//
+//	{ "rules": [ { "type": "collscan", "severity": "E", "threshold": 100000 } ] }
+type RulesConfig struct {
+	Rules []RuleConfig `json:"rules"`
+}
+
+// ruleCheck returns the description of the problem if the entry has it
+type ruleCheck func(entry *MongoLogEntry, threshold float64) (message string, found bool)
+
+type ruleType struct {
+	check     ruleCheck
+	threshold float64
+}
+
+var ruleTypes = map[string]ruleType{
+	// The documents examined per document returned is over the threshold
+	"docsExaminedRatio": {checkDocsExaminedRatio, 100},
+	// The results were sorted in memory, either a SORT plan stage or hasSortStage
+	"inMemorySort": {checkInMemorySort, 0},
+	// A collection scan examined at least threshold documents, ie. the collection is large
+	"collscan": {checkCollscan, 10000},
+	// The query uses $where, which runs JavaScript for every document
+	"where": {checkWhere, 0},
+	// The query uses a regex that is not anchored to the start and so can't use an index well
+	"unanchoredRegex": {checkUnanchoredRegex, 0},
+	// A $in or $nin list has more than threshold values
+	"largeIn": {checkLargeIn, 200},
+	// The operation yielded more than threshold times
+	"numYields": {checkNumYields, 1000},
+}
+
+// RuleTypes returns the names of the rule types
+func RuleTypes() []string {
+	types := make([]string, 0, len(ruleTypes))
+	for name := range ruleTypes {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DefaultRulesConfig returns the configuration with all the rule types with the default settings
+func DefaultRulesConfig() RulesConfig {
+	var config RulesConfig
+	for _, name := range RuleTypes() {
+		config.Rules = append(config.Rules, RuleConfig{Type: name})
+	}
+	return config
+}
+
+// LoadRulesConfig reads the JSON rule engine configuration. YAML is not supported, the package
+// has no YAML dependency and the configuration is simple enough to write as JSON.
+func LoadRulesConfig(r io.Reader) (config RulesConfig, err error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid rules config: %v", err)
+	}
+	return
+}
+
+type rule struct {
+	name      string
+	severity  Severity
+	threshold float64
+	check     ruleCheck
+}
+
+// RuleEngine checks the log entries against the configured rules. It is safe for concurrent use.
+type RuleEngine struct {
+	rules []rule
+}
+
+func NewRuleEngine(config RulesConfig) (*RuleEngine, error) {
+	engine := &RuleEngine{}
+	for _, c := range config.Rules {
+		t, ok := ruleTypes[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown rule type %q, expected one of: %v", c.Type,
+				strings.Join(RuleTypes(), ", "))
+		}
+		if c.Disabled {
+			continue
+		}
+
+		r := rule{name: c.Name, severity: c.Severity, threshold: t.threshold, check: t.check}
+		if r.name == "" {
+			r.name = c.Type
+		}
+		if r.severity == "" {
+			r.severity = Warning
+		} else if !r.severity.Known() {
+			return nil, fmt.Errorf("%v: unknown severity %q", r.name, r.severity)
+		}
+		if c.Threshold != nil {
+			r.threshold = *c.Threshold
+		}
+		engine.rules = append(engine.rules, r)
+	}
+	return engine, nil
+}
+
+// Check returns the problems found in the entry, one finding per rule at most
+func (engine *RuleEngine) Check(entry *MongoLogEntry) (findings []*Finding) {
+	for _, r := range engine.rules {
+		if message, found := r.check(entry, r.threshold); found {
+			findings = append(findings, &Finding{
+				Rule:     r.name,
+				Severity: r.severity,
+				Message:  message,
+				Entry:    entry,
+			})
+		}
+	}
+	return
+}
+
+func checkDocsExaminedRatio(entry *MongoLogEntry, threshold float64) (string, bool) {
+	stats := entry.ExecStats
+	if stats == nil || stats.DocsExamined == 0 {
+		return "", false
+	}
+	returned := stats.NReturned
+	if returned == 0 {
+		returned = 1
+	}
+	ratio := float64(stats.DocsExamined) / float64(returned)
+	if ratio <= threshold {
+		return "", false
+	}
+	return fmt.Sprintf("examined %d documents to return %d", stats.DocsExamined, stats.NReturned), true
+}
+
+func checkInMemorySort(entry *MongoLogEntry, _ float64) (string, bool) {
+	if entry.PlanInfo.HasStage("SORT") || (entry.ExecStats != nil && entry.ExecStats.HasSortStage) {
+		return "sorted in memory", true
+	}
+	return "", false
+}
+
+func checkCollscan(entry *MongoLogEntry, threshold float64) (string, bool) {
+	if !entry.PlanInfo.HasStage("COLLSCAN") {
+		return "", false
+	}
+	var examined int64
+	if entry.ExecStats != nil {
+		examined = entry.ExecStats.DocsExamined
+	}
+	if float64(examined) < threshold {
+		return "", false
+	}
+	return fmt.Sprintf("collection scan examined %d documents", examined), true
+}
+
+func checkWhere(entry *MongoLogEntry, _ float64) (message string, found bool) {
+	walkQueryFilters(entry, func(key string, v *Value) bool {
+		found = key == "$where"
+		return !found
+	})
+	return "$where used", found
+}
+
+func checkUnanchoredRegex(entry *MongoLogEntry, _ float64) (message string, found bool) {
+	walkQueryFilters(entry, func(key string, v *Value) bool {
+		pattern := ""
+		switch {
+		case v.Kind == KindRegex:
+			pattern = v.RegexValue.Pattern
+		case key == "$regex" && v.Kind == KindString:
+			pattern = v.StringValue
+		default:
+			return true
+		}
+		if strings.HasPrefix(pattern, "^") || strings.HasPrefix(pattern, `\A`) {
+			return true
+		}
+		message, found = fmt.Sprintf("unanchored regex /%v/", pattern), true
+		return false
+	})
+	return
+}
+
+func checkLargeIn(entry *MongoLogEntry, threshold float64) (message string, found bool) {
+	walkQueryFilters(entry, func(key string, v *Value) bool {
+		if (key == "$in" || key == "$nin") && v.Kind == KindArray && float64(len(v.ArrayValue)) > threshold {
+			message, found = fmt.Sprintf("%v with %d values", key, len(v.ArrayValue)), true
+		}
+		return !found
+	})
+	return
+}
+
+func checkNumYields(entry *MongoLogEntry, threshold float64) (string, bool) {
+	if entry.ExecStats == nil || float64(entry.ExecStats.NumYields) <= threshold {
+		return "", false
+	}
+	return fmt.Sprintf("yielded %d times", entry.ExecStats.NumYields), true
+}
+
+// walkQueryFilters calls fn for every key and value in the query filters of the entry, the
+// filter of the command and the $match stages of the pipeline. The walk stops when fn returns
+// false.
+func walkQueryFilters(entry *MongoLogEntry, fn func(key string, v *Value) bool) {
+	if entry.CommandParameters == nil {
+		return
+	}
+
+	var filters []*PseudoJson
+	if filter, _, _ := queryDocuments(entry.Command, entry.CommandParameters); filter != nil {
+		filters = append(filters, filter)
+	}
+	if pipeline := entry.CommandParameters.Get("pipeline"); pipeline != nil && pipeline.Kind == KindArray {
+		for _, stage := range pipeline.ArrayValue {
+			if match := stage.Get("$match"); match != nil && match.Kind == KindDocument {
+				filters = append(filters, match.Nested)
+			}
+		}
+	}
+
+	for _, filter := range filters {
+		if !walkDocument(filter, fn) {
+			return
+		}
+	}
+}
+
+func walkDocument(doc *PseudoJson, fn func(key string, v *Value) bool) (more bool) {
+	more = true
+	doc.Range(func(key string, v *Value) bool {
+		more = walkValue(key, v, fn)
+		return more
+	})
+	return
+}
+
+func walkValue(key string, v *Value, fn func(key string, v *Value) bool) bool {
+	if !fn(key, v) {
+		return false
+	}
+	switch v.Kind {
+	case KindDocument:
+		return walkDocument(v.Nested, fn)
+	case KindArray:
+		for _, elem := range v.ArrayValue {
+			if !walkValue("", elem, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package mongolog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRuleEngine(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.cats command: find` +
+		` { find: "cats", filter: %v } planSummary: %v keysExamined:0 docsExamined:%d %v` +
+		`numYields:%d nreturned:%d reslen:100 protocol:op_msg 150ms`
+
+	testMessages := []struct {
+		filter    string
+		plan      string
+		docs      int
+		sortStage string
+		yields    int
+		nreturned int
+		expect    []string
+	}{
+		{`{ a: 1 }`, `IXSCAN { a: 1 }`, 1, ``, 0, 1, nil},
+		{`{ a: 1 }`, `COLLSCAN`, 50000, ``, 0, 1, []string{"collscan", "docsExaminedRatio"}},
+		{`{ a: 1 }`, `COLLSCAN`, 50, ``, 0, 1, nil},
+		{`{ a: 1 }`, `IXSCAN { a: 1 }`, 10, `hasSortStage:1 `, 5000, 10, []string{"inMemorySort", "numYields"}},
+		{`{ a: 1 }`, `SORT, IXSCAN { a: 1 }`, 10, ``, 0, 10, []string{"inMemorySort"}},
+		{`{ $where: "this.a == 1" }`, `COLLSCAN`, 10, ``, 0, 10, []string{"where"}},
+		{`{ a: /foo/ }`, `COLLSCAN`, 10, ``, 0, 10, []string{"unanchoredRegex"}},
+		{`{ a: /^foo/, b: { $regex: "^bar" } }`, `IXSCAN { a: 1 }`, 10, ``, 0, 10, nil},
+		{`{ $or: [ { b: { $regex: "bar", $options: "i" } } ] }`, `COLLSCAN`, 10, ``, 0, 10,
+			[]string{"unanchoredRegex"}},
+		{fmt.Sprintf(`{ a: { $in: [ %v1 ] } }`, strings.Repeat("1, ", 200)), `IXSCAN { a: 1 }`, 10, ``, 0, 10,
+			[]string{"largeIn"}},
+	}
+
+	engine, err := NewRuleEngine(DefaultRulesConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parser, _ := NewLogParser()
+	for _, v := range testMessages {
+		m, err := parser.Parse(fmt.Sprintf(logLine, v.filter, v.plan, v.docs, v.sortStage, v.yields, v.nreturned))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+
+		var rules []string
+		for _, f := range engine.Check(&m) {
+			rules = append(rules, f.Rule)
+			if f.Entry != &m || f.Severity != Warning || f.Message == "" {
+				t.Errorf("unexpected finding: %+v", f)
+			}
+		}
+		if fmt.Sprint(rules) != fmt.Sprint(v.expect) {
+			t.Errorf("%v %v: expected %v, got %v", v.filter, v.plan, v.expect, rules)
+		}
+	}
+
+	legacy := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] getmore FooDb.cats` +
+		` query: { a: /foo/, $where: "this.b == 1" } planSummary: COLLSCAN cursorid:12345 ntoreturn:0` +
+		` keysExamined:0 docsExamined:10 numYields:0 nreturned:10 reslen:4000 15ms`
+	m, err := parser.Parse(legacy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var rules []string
+	for _, f := range engine.Check(&m) {
+		rules = append(rules, f.Rule)
+	}
+	if fmt.Sprint(rules) != "[unanchoredRegex where]" {
+		t.Errorf("legacy getmore: unexpected findings %v", rules)
+	}
+}
+
+func TestRulesConfig(t *testing.T) {
+	config, err := LoadRulesConfig(strings.NewReader(`{ "rules": [
+		{ "name": "big-scan", "type": "collscan", "severity": "E", "threshold": 100 },
+		{ "type": "where", "disabled": true },
+		{ "type": "numYields", "threshold": 0 }
+	] }`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	engine, err := NewRuleEngine(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.cats command: find` +
+		` { find: "cats", filter: { $where: "1" } } planSummary: COLLSCAN keysExamined:0 docsExamined:100` +
+		` numYields:1 nreturned:1 reslen:100 protocol:op_msg 150ms`
+	parser, _ := NewLogParser()
+	m, err := parser.Parse(logLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	findings := engine.Check(&m)
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got %v", findings)
+	}
+	if f := findings[0]; f.Rule != "big-scan" || f.Severity != Error || !f.Severity.AtLeast(Warning) {
+		t.Errorf("unexpected finding: %v", f)
+	}
+	if f := findings[1]; f.Rule != "numYields" || f.Severity != Warning {
+		t.Errorf("unexpected finding: %v", f)
+	}
+
+	for _, invalid := range []string{
+		`{ "rules": [ { "type": "foo" } ] }`,
+		`{ "rules": [ { "type": "where", "severity": "X" } ] }`,
+	} {
+		config, err := LoadRulesConfig(strings.NewReader(invalid))
+		if err == nil {
+			_, err = NewRuleEngine(config)
+		}
+		if err == nil {
+			t.Errorf("%v: expected an error", invalid)
+		}
+	}
+	if _, err := LoadRulesConfig(strings.NewReader(`{ "rules": [ { "typo": "where" } ] }`)); err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+}
@@ -0,0 +1,54 @@
+package mongolog
+
+// Severity is the severity level of the log entry, as logged by mongod
+type Severity string
+
+const (
+	Fatal   Severity = "F"
+	Error   Severity = "E"
+	Warning Severity = "W"
+	Info    Severity = "I"
+	Debug1  Severity = "D1"
+	Debug2  Severity = "D2"
+	Debug3  Severity = "D3"
+	Debug4  Severity = "D4"
+	Debug5  Severity = "D5"
+)
+
+// The severities ordered by importance, the older mongods log all the debug levels as plain D
+var severityLevels = map[Severity]int{
+	Debug5:  1,
+	Debug4:  2,
+	Debug3:  3,
+	Debug2:  4,
+	Debug1:  5,
+	"D":     5,
+	Info:    6,
+	Warning: 7,
+	Error:   8,
+	Fatal:   9,
+}
+
+// Known returns true if the severity is one of the levels logged by mongod
+func (s Severity) Known() bool {
+	_, ok := severityLevels[s]
+	return ok
+}
+
+// AtLeast returns true if the severity is the same as or more severe than the level. Unknown
+// severities are below all the levels.
+func (s Severity) AtLeast(level Severity) bool {
+	return severityLevels[s] >= severityLevels[level]
+}
+
+// Verbosity returns the debug level 1-5 of the debug severities, and 0 for the others
+func (s Severity) Verbosity() int {
+	if !s.Known() || s.AtLeast(Info) {
+		return 0
+	}
+	return severityLevels[Info] - severityLevels[s]
+}
+
+func (s Severity) String() string {
+	return string(s)
+}
@@ -0,0 +1,34 @@
+package mongolog
+
+import (
+	"testing"
+)
+
+func TestSeverityAtLeast(t *testing.T) {
+	ordered := []Severity{Debug5, Debug4, Debug3, Debug2, Debug1, Info, Warning, Error, Fatal}
+	for i, s := range ordered {
+		for j, level := range ordered {
+			if s.AtLeast(level) != (i >= j) {
+				t.Errorf("%v.AtLeast(%v): expected %v", s, level, i >= j)
+			}
+		}
+	}
+
+	if !Severity("D").AtLeast(Debug1) || Severity("D").AtLeast(Info) {
+		t.Errorf("plain D should be the same as D1")
+	}
+	if Severity("X").Known() || Severity("X").AtLeast(Debug5) {
+		t.Errorf("unknown severity should be below all the levels")
+	}
+}
+
+func TestSeverityVerbosity(t *testing.T) {
+	expect := map[Severity]int{
+		Debug1: 1, Debug3: 3, Debug5: 5, "D": 1, Info: 0, Warning: 0, Fatal: 0, "X": 0,
+	}
+	for s, v := range expect {
+		if s.Verbosity() != v {
+			t.Errorf("%v: expected verbosity %v, got %v", s, v, s.Verbosity())
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package mongolog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// The placeholder of the literal values in the query shapes
+const shapePlaceholder = "?"
+
+// QueryShape is the query of a log entry with the literal values replaced by placeholders, so
+// that the queries that differ only by the values can be grouped together.
+type QueryShape struct {
+	Command   string
+	Namespace string
+	// Filter is the normalised filter, ie. { a: ?, b: { $in: [ ? ] } }
+	Filter string
+	// Sort and Projection are kept as they were logged, they have no literal values to speak of
+	Sort       string
+	Projection string
+	// Pipeline is the normalised aggregation pipeline, empty for the other commands
+	Pipeline string
+}
+
+// Where the query parts are in the command parameters. The first path that is found is used.
+type queryPaths struct {
+	filter     []string
+	sort       []string
+	projection []string
+}
+
+var queryCommandPaths = map[string]queryPaths{
+	"find":          {[]string{"filter"}, []string{"sort"}, []string{"projection"}},
+	"count":         {[]string{"query"}, nil, nil},
+	"distinct":      {[]string{"query"}, nil, nil},
+	"findAndModify": {[]string{"query"}, []string{"sort"}, []string{"fields"}},
+	"update":        {[]string{"updates.0.q", "command.q", "query"}, nil, nil},
+	"delete":        {[]string{"deletes.0.q", "command.q", "query"}, nil, nil},
+	"remove":        {[]string{"query"}, nil, nil},
+	"getMore":       {[]string{"originatingCommand.filter"}, []string{"originatingCommand.sort"}, nil},
+	"query":         legacyQueryPaths,
+	"getmore":       legacyQueryPaths,
+}
+
+// The legacy query documents either are the filter or wrap it with the modifiers
+var legacyQueryPaths = queryPaths{
+	[]string{"query.$query", "query.query", "query"},
+	[]string{"query.$orderby", "query.orderby"},
+	nil,
+}
+
+// The legacy operations that are the same as the commands, for the shapes to match
+var legacyCommandNames = map[string]string{
+	"query":   "find",
+	"remove":  "delete",
+	"getmore": "getMore",
+}
+
+// Operators whose array argument is collapsed into a single placeholder, the number of values
+// doesn't change the shape.
+var collapsedArrayOperators = map[string]bool{
+	"$in":  true,
+	"$nin": true,
+	"$all": true,
+}
+
+// NewQueryShape returns the query shape of the entry, or nil if the entry has no command
+// parameters. The commands other than the query commands get just the command and namespace.
+func NewQueryShape(entry *MongoLogEntry) *QueryShape {
+	params := entry.CommandParameters
+	if params == nil {
+		return nil
+	}
+
+	shape := &QueryShape{Command: entry.Command, Namespace: entry.Namespace}
+	if name, ok := legacyCommandNames[shape.Command]; ok {
+		shape.Command = name
+	}
+
+	filter, sortSpec, projection := queryDocuments(entry.Command, params)
+	if filter != nil {
+		shape.Filter = normaliseDocument(filter, true)
+	}
+	if sortSpec != nil {
+		shape.Sort = normaliseDocument(sortSpec, false)
+	}
+	if projection != nil {
+		shape.Projection = normaliseDocument(projection, false)
+	}
+	if pipeline := params.Get("pipeline"); pipeline != nil && pipeline.Kind == KindArray {
+		shape.Pipeline = normalisePipeline(pipeline.ArrayValue)
+	}
+	return shape
+}
+
+// queryDocuments finds the filter, sort and projection documents in the command parameters
+func queryDocuments(command string, params *PseudoJson) (filter, sortSpec, projection *PseudoJson) {
+	paths, ok := queryCommandPaths[command]
+	if !ok {
+		// Generic commands, and the explain of the commands
+		paths = queryCommandPaths["find"]
+		if explain := params.GetDocument("explain"); explain != nil {
+			params = explain
+		}
+	}
+
+	find := func(paths []string) *PseudoJson {
+		for _, path := range paths {
+			if doc := params.GetDocument(path); doc != nil {
+				return doc
+			}
+		}
+		return nil
+	}
+
+	return find(paths.filter), find(paths.sort), find(paths.projection)
+}
+
+func (shape *QueryShape) String() string {
+	if pattern := shape.Pattern(); pattern != "" {
+		return shape.Command + " " + shape.Namespace + " " + pattern
+	}
+	return shape.Command + " " + shape.Namespace
+}
+
+// Pattern returns the filter, sort, projection and pipeline parts of the shape
+func (shape *QueryShape) Pattern() string {
+	var parts []string
+	for _, part := range []struct{ name, value string }{
+		{"filter", shape.Filter},
+		{"sort", shape.Sort},
+		{"projection", shape.Projection},
+		{"pipeline", shape.Pipeline},
+	} {
+		if part.value != "" {
+			parts = append(parts, part.name+": "+part.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Hash returns a stable hash of the query shape as a hex string
+func (shape *QueryShape) Hash() string {
+	h := fnv.New64a()
+	h.Write([]byte(shape.String()))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// normaliseDocument formats the document with the literal values replaced by placeholders. The
+// order of the filter keys doesn't change the result, so these are sorted.
+func normaliseDocument(doc *PseudoJson, literals bool) string {
+	elements := make([]string, 0, len(doc.Elements))
+	for _, e := range doc.Elements {
+		elements = append(elements, e.Key+": "+normaliseValue(e.Key, e.Val, literals))
+	}
+	if len(elements) == 0 {
+		return "{}"
+	}
+	if literals {
+		sort.Strings(elements)
+	}
+	return "{ " + strings.Join(elements, ", ") + " }"
+}
+
+func normaliseValue(key string, v *Value, literals bool) string {
+	switch v.Kind {
+	case KindDocument:
+		return normaliseDocument(v.Nested, literals)
+	case KindArray:
+		if !literals {
+			return formatArray(v.ArrayValue, func(v *Value) string { return normaliseValue("", v, false) })
+		}
+		if collapsedArrayOperators[key] {
+			return "[ " + shapePlaceholder + " ]"
+		}
+		// Arrays of subqueries ($and, $or, $nor) keep their structure, the others are literals
+		for _, elem := range v.ArrayValue {
+			if elem.Kind != KindDocument {
+				return shapePlaceholder
+			}
+		}
+		return formatArray(v.ArrayValue, func(v *Value) string { return normaliseValue("", v, true) })
+	}
+	if literals {
+		return shapePlaceholder
+	}
+	return formatScalar(v)
+}
+
+// normalisePipeline keeps the stages of the pipeline. The $match filters are normalised, the
+// $sort stages kept as is and the arguments of the other stages replaced by a placeholder.
+func normalisePipeline(stages []*Value) string {
+	return formatArray(stages, func(stage *Value) string {
+		if stage.Kind != KindDocument || len(stage.Nested.Elements) == 0 {
+			return shapePlaceholder
+		}
+		name := stage.Nested.Elements[0].Key
+		arg := stage.Nested.Elements[0].Val
+		switch {
+		case name == "$match" && arg.Kind == KindDocument:
+			return "{ $match: " + normaliseDocument(arg.Nested, true) + " }"
+		case name == "$sort" && arg.Kind == KindDocument:
+			return "{ $sort: " + normaliseDocument(arg.Nested, false) + " }"
+		}
+		return "{ " + name + ": " + shapePlaceholder + " }"
+	})
+}
+
+func formatArray(values []*Value, format func(v *Value) string) string {
+	if len(values) == 0 {
+		return "[]"
+	}
+	elements := make([]string, 0, len(values))
+	for _, v := range values {
+		elements = append(elements, format(v))
+	}
+	return "[ " + strings.Join(elements, ", ") + " ]"
+}
+
+// formatScalar formats the sort and projection values, these are mostly 1 and -1
+func formatScalar(v *Value) string {
+	switch v.Kind {
+	case KindNumber:
+		return fmt.Sprint(v.NumericValue)
+	case KindBool:
+		return fmt.Sprint(v.BoolValue)
+	case KindString:
+		return fmt.Sprintf("%q", v.StringValue)
+	case KindNull:
+		return "null"
+	}
+	return shapePlaceholder
+}
@@ -0,0 +1,116 @@
+package mongolog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryShape(t *testing.T) {
+	testMessages := []struct {
+		logLine string
+		expect  string
+	}{
+		{
+			`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.cats command: find { find: "cats",` +
+				` filter: { name: "Tom", age: { $gte: 3, $lt: 10 }, color: { $in: [ "red", "black", "white" ] } },` +
+				` sort: { age: -1 }, projection: { name: 1, _id: 0 }, limit: 10 } planSummary: COLLSCAN` +
+				` keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg 150ms`,
+			`find FooDb.cats filter: { age: { $gte: ?, $lt: ? }, color: { $in: [ ? ] }, name: ? }` +
+				` sort: { age: -1 } projection: { name: 1, _id: 0 }`,
+		},
+		{
+			`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.cats command: find { find: "cats",` +
+				` filter: { $or: [ { _id: ObjectId('5a8c3a142053a407a936745e') }, { tags: [ "a", "b" ] } ] } }` +
+				` planSummary: IXSCAN { _id: 1 } keysExamined:1 docsExamined:1 numYields:0 nreturned:1 150ms`,
+			`find FooDb.cats filter: { $or: [ { _id: ? }, { tags: ? } ] }`,
+		},
+		{
+			`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.cats command: aggregate` +
+				` { aggregate: "cats", pipeline: [ { $match: { color: "red" } }, { $group: { _id: "$age" } },` +
+				` { $sort: { _id: 1 } } ], cursor: {} } planSummary: COLLSCAN keysExamined:0` +
+				` docsExamined:100 numYields:0 nreturned:5 reslen:100 protocol:op_msg 150ms`,
+			`aggregate FooDb.cats pipeline: [ { $match: { color: ? } }, { $group: ? }, { $sort: { _id: 1 } } ]`,
+		},
+		{
+			`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] query FooDb.cats query: { $query: { name: "Tom" },` +
+				` $orderby: { age: 1 } } planSummary: COLLSCAN ntoreturn:0 keysExamined:0 docsExamined:100` +
+				` nreturned:1 numYields:0 reslen:100 150ms`,
+			`find FooDb.cats filter: { name: ? } sort: { age: 1 }`,
+		},
+		{
+			`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] getmore FooDb.cats query: { a: 5, b: 2 }` +
+				` planSummary: COLLSCAN cursorid:12345 ntoreturn:0 keysExamined:0 docsExamined:200` +
+				` numYields:1 nreturned:101 reslen:4000 15ms`,
+			`getMore FooDb.cats filter: { a: ?, b: ? }`,
+		},
+		{
+			`2018-10-05T14:01:04.067+0000 I WRITE    [conn1] remove FooDb.cats query: { a: 3 }` +
+				` planSummary: COLLSCAN keysExamined:0 docsExamined:10 ndeleted:1 numYields:0 1ms`,
+			`delete FooDb.cats filter: { a: ? }`,
+		},
+		{
+			`2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.$cmd command: createIndexes` +
+				` { createIndexes: "cats", indexes: [ { key: { a: 1 }, name: "a_1" } ] } numYields:0` +
+				` reslen:100 protocol:op_msg 1200ms`,
+			`createIndexes FooDb.$cmd`,
+		},
+	}
+
+	parser, _ := NewLogParser()
+	for _, v := range testMessages {
+		m, err := parser.Parse(v.logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", v.logLine, err)
+			continue
+		}
+		shape := NewQueryShape(&m)
+		if shape == nil {
+			t.Errorf("no shape for %v", v.logLine)
+			continue
+		}
+		if shape.String() != v.expect {
+			t.Errorf("unexpected shape:\n%v\nexpected:\n%v", shape, v.expect)
+		}
+	}
+
+	if NewQueryShape(&MongoLogEntry{}) != nil {
+		t.Errorf("expected no shape for an entry without command parameters")
+	}
+}
+
+func TestQueryShapeHash(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.cats command: find` +
+		` { find: "cats", filter: %v } planSummary: COLLSCAN keysExamined:0 docsExamined:100` +
+		` numYields:0 nreturned:1 reslen:100 protocol:op_msg 150ms`
+
+	hash := func(filter string) string {
+		parser, _ := NewLogParser()
+		m, err := parser.Parse(fmt.Sprintf(logLine, filter))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return NewQueryShape(&m).Hash()
+	}
+
+	same := hash(`{ a: 1, b: { $in: [ 1, 2, 3 ] } }`)
+	if len(same) != 16 {
+		t.Errorf("unexpected hash: %v", same)
+	}
+	for _, filter := range []string{
+		`{ a: 2, b: { $in: [ 4 ] } }`,
+		`{ b: { $in: [] }, a: "foo" }`,
+	} {
+		if h := hash(filter); h != same {
+			t.Errorf("%v: expected hash %v, got %v", filter, same, h)
+		}
+	}
+	for _, filter := range []string{
+		`{ a: 1 }`,
+		`{ a: 1, b: { $nin: [ 1, 2, 3 ] } }`,
+		`{ a: 1, c: { $in: [ 1, 2, 3 ] } }`,
+	} {
+		if h := hash(filter); h == same {
+			t.Errorf("%v: expected a different hash", filter)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package mongolog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"runtime"
+)
+
+// Mongo logs can have lines of several megabytes, ie. large aggregate pipelines
+const maxStreamLineSize = 64 * 1024 * 1024
+
+// Result is a log entry parsed by ParseStream
+type Result struct {
+	LineNumber int
+	LogLine    string
+	Entry      MongoLogEntry
+	Err        error
+}
+
+type streamJob struct {
+	result Result
+	body   bodyParser
+	done   chan Result
+}
+
+// ParseStream parses the log lines read from r and sends the results to the returned channel in
+// the order of the lines. The cheap part of the parsing, the header and connection tracking, is
+// done in the reading goroutine as it depends on the order of the lines. The command parameters
+// are parsed by a pool of workers, if workers is < 1 runtime.NumCPU() is used.
+//
+// The channel is closed when the input is exhausted or ctx is done. A read error is sent as the
+// last Result, with a zero LineNumber. The caller must either drain the channel or cancel ctx.
+func (parser *LogParser) ParseStream(ctx context.Context, r io.Reader, workers int) <-chan Result {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make(chan Result, workers)
+	jobs := make(chan *streamJob, workers)
+	// The order in which the jobs are emitted, also bounds the number of lines in flight
+	pending := make(chan *streamJob, workers*16)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				err := job.body(&job.result.Entry)
+				job.result.Err = withLine(&job.result.Entry, err, job.result.LogLine)
+				job.done <- job.result
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxStreamLineSize)
+
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			job := &streamJob{done: make(chan Result, 1)}
+			job.result.LineNumber = lineNumber
+			job.result.LogLine = scanner.Text()
+			job.result.Entry, job.body, job.result.Err = parser.parseHeader(job.result.LogLine)
+			job.result.Err = withLine(&job.result.Entry, job.result.Err, job.result.LogLine)
+
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+				return
+			}
+
+			if job.result.Err != nil || job.body == nil {
+				job.done <- job.result
+				continue
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			job := &streamJob{done: make(chan Result, 1)}
+			job.done <- Result{Err: err}
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	go func() {
+		defer close(results)
+		for job := range pending {
+			var result Result
+			select {
+			case result = <-job.done:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return results
+}
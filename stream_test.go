@@ -0,0 +1,97 @@
+package mongolog
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func streamTestLog(n int) []string {
+	var lines []string
+	for i := 0; i < n; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i%256)
+		// The connection ids are reused so that the entries depend on the order of the lines
+		conn := fmt.Sprint(i % 7)
+		lines = append(lines,
+			`2018-10-05T14:01:04.067+0000 I NETWORK  [listener] connection accepted from `+ip+
+				`:47878 #`+conn+` (1 connection now open)`,
+			`2018-10-05T14:01:04.068+0000 I NETWORK  [conn`+conn+`] received client metadata from `+
+				ip+`:47878 conn`+conn+`: { application: { name: "app`+fmt.Sprint(i)+`" } }`,
+			`2018-10-05T14:01:04.069+0000 I COMMAND  [conn`+conn+`] command FooDb.foo command:`+
+				` find { find: "foo", filter: { a: `+fmt.Sprint(i)+` }, $db: "FooDb" }`+
+				` planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 nreturned:1`+
+				` reslen:100 locks:{ Global: { acquireCount: { r: 1 } } } 1ms`,
+			`{"t":{"$date":"2020-05-20T19:18:40.604+00:00"},"s":"I","c":"COMMAND","id":51803,`+
+				`"ctx":"conn`+conn+`","msg":"Slow query","attr":{"type":"command","ns":"FooDb.bar",`+
+				`"command":{"find":"bar","filter":{"b":`+fmt.Sprint(i)+`}},"planSummary":"COLLSCAN",`+
+				`"durationMillis":5}}`,
+			`not a log line`,
+			`2018-10-05T14:01:04.070+0000 I NETWORK  [conn`+conn+`] end connection `+ip+
+				`:47878 (0 connections now open)`,
+		)
+	}
+	return lines
+}
+
+func TestParseStream(t *testing.T) {
+	lines := streamTestLog(100)
+
+	sequential, _ := NewLogParser()
+	var expect []Result
+	for i, line := range lines {
+		m, err := sequential.Parse(line)
+		expect = append(expect, Result{LineNumber: i + 1, LogLine: line, Entry: m, Err: err})
+	}
+
+	for _, workers := range []int{0, 1, 4, 16} {
+		parser, _ := NewLogParserWithOptions(LogParserOptions{FastPseudoJson: workers == 4})
+		input := strings.NewReader(strings.Join(lines, "\n"))
+
+		var got []Result
+		for result := range parser.ParseStream(context.Background(), input, workers) {
+			got = append(got, result)
+		}
+
+		if len(got) != len(expect) {
+			t.Errorf("workers %v: expected %v results, got %v", workers, len(expect), len(got))
+			continue
+		}
+		for i := range expect {
+			if !reflect.DeepEqual(got[i], expect[i]) {
+				t.Errorf("workers %v: line %v mismatch:\n%+v\n%+v", workers, i+1, got[i], expect[i])
+				break
+			}
+		}
+	}
+}
+
+func TestParseStreamCancel(t *testing.T) {
+	parser, _ := NewLogParser()
+	input := strings.NewReader(strings.Join(streamTestLog(1000), "\n"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := parser.ParseStream(ctx, input, 4)
+	for i := 0; i < 10; i++ {
+		<-results
+	}
+	cancel()
+
+	// The channel must get closed without reading the rest of the input
+	n := 0
+	for range results {
+		n++
+	}
+	if n >= 6000-10 {
+		t.Errorf("stream was not cancelled, got %v more results", n)
+	}
+}
+
+func BenchmarkParseStream(b *testing.B) {
+	log := strings.Join(streamTestLog(b.N), "\n")
+	parser, _ := NewLogParserWithOptions(LogParserOptions{FastPseudoJson: true})
+	b.ResetTimer()
+	for range parser.ParseStream(context.Background(), strings.NewReader(log), 0) {
+	}
+}
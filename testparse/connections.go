@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mpihlak/mongolog"
+)
+
+// connections prints the connection summaries by client IP and application, and the churn
+func connections(args []string) {
+	flags := flag.NewFlagSet("connections", flag.ExitOnError)
+	interval := flags.Duration("interval", time.Minute, "interval of the connection churn")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s connections [-interval 1m] [logfile]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	file := openLog(flags.Args())
+	defer file.Close()
+	parser := newParser()
+
+	tracker := mongolog.NewConnectionTracker(*interval)
+	for result := range parser.ParseStream(context.Background(), file, runtime.NumCPU()) {
+		if result.LineNumber == 0 {
+			panic(result.Err)
+		}
+		if result.Err == nil {
+			tracker.Add(&result.Entry)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, group := range []struct {
+		name      string
+		summaries []*mongolog.ConnectionSummary
+	}{
+		{"client", tracker.ByClientIP()},
+		{"appName", tracker.ByAppName()},
+	} {
+		fmt.Fprintf(w, "%v\tconnections\topened\tclosed\tmean duration\tcommands\tcommand time\n", group.name)
+		for _, s := range group.summaries {
+			key := s.Key
+			if key == "" {
+				key = "-"
+			}
+			fmt.Fprintf(w, "%v\t%d\t%d\t%d\t%v\t%d\t%v\n", key, s.Connections, s.Opened, s.Closed,
+				s.MeanDuration().Round(time.Millisecond), s.Commands, s.CommandTime)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "interval\topened\tclosed\topened/s\n")
+	for _, c := range tracker.Churn() {
+		fmt.Fprintf(w, "%v\t%d\t%d\t%.2f\n", c.Start.Format(time.RFC3339), c.Opened, c.Closed, c.Rate())
+	}
+	w.Flush()
+	fmt.Printf("\nconnections seen %d, open at the end %d\n", len(tracker.Connections()), tracker.Open())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/mpihlak/mongolog"
+)
+
+// indexes prints the indexes suggested for the collection scanning queries of the log
+func indexes(args []string) {
+	file := openLog(args)
+	defer file.Close()
+	parser := newParser()
+
+	advisor := mongolog.NewIndexAdvisor()
+	for result := range parser.ParseStream(context.Background(), file, runtime.NumCPU()) {
+		if result.LineNumber == 0 {
+			panic(result.Err)
+		}
+		if result.Err == nil {
+			advisor.Add(&result.Entry)
+		}
+	}
+
+	for _, s := range advisor.Suggestions() {
+		fmt.Printf("%v\n  queries: %d\n", s, s.Count)
+		for _, shape := range s.Shapes {
+			fmt.Printf("  shape: %v\n", shape.Pattern())
+		}
+		for _, keys := range s.Redundant {
+			fmt.Printf("  makes redundant: %v\n", mongolog.FormatKeyPattern(keys))
+		}
+		fmt.Println()
+	}
+}
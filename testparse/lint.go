@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+
+	"github.com/mpihlak/mongolog"
+)
+
+// lint checks the log entries against the rules and prints the findings
+func lint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	configFile := flags.String("config", "",
+		"JSON rules config (YAML is not supported), all the rules with the defaults if not set")
+	minSeverity := flags.String("severity", "I", "report only the findings of at least this severity")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s lint [-config rules.json] [-severity W] [logfile]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	config := mongolog.DefaultRulesConfig()
+	if *configFile != "" {
+		f, err := os.Open(*configFile)
+		if err != nil {
+			panic(err)
+		}
+		config, err = mongolog.LoadRulesConfig(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	engine, err := mongolog.NewRuleEngine(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	file := openLog(flags.Args())
+	defer file.Close()
+	parser := newParser()
+
+	counts := make(map[string]int)
+	for result := range parser.ParseStream(context.Background(), file, runtime.NumCPU()) {
+		if result.LineNumber == 0 {
+			panic(result.Err)
+		}
+		if result.Err != nil {
+			continue
+		}
+		for _, f := range engine.Check(&result.Entry) {
+			if !f.Severity.AtLeast(mongolog.Severity(*minSeverity)) {
+				continue
+			}
+			counts[f.Rule]++
+			fmt.Printf("line %d: %v\n", result.LineNumber, f)
+		}
+	}
+
+	rules := make([]string, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	fmt.Println()
+	for _, rule := range rules {
+		fmt.Printf("%v: %d\n", rule, counts[rule])
+	}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"runtime"
 
 	"github.com/mpihlak/mongolog"
 )
@@ -16,34 +17,68 @@ func dumpContext(s string, m map[string]string) {
 	fmt.Println()
 }
 
-func main() {
-	file := os.Stdin
-
-	if len(os.Args) == 2 {
-		var err error
-		file, err = os.Open(os.Args[1])
-		if err != nil {
-			panic(err)
-		}
-		defer file.Close()
+// openLog opens the log file of the arguments, or stdin if there's none
+func openLog(args []string) *os.File {
+	if len(args) == 0 {
+		return os.Stdin
 	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		panic(err)
+	}
+	return file
+}
 
-	scanner := bufio.NewScanner(file)
-	parser, err := mongolog.NewLogParser()
+func newParser() *mongolog.LogParser {
+	parser, err := mongolog.NewLogParserWithOptions(mongolog.LogParserOptions{FastPseudoJson: true})
 	if err != nil {
 		panic(err)
 	}
+	return parser
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			report(os.Args[2:])
+			return
+		case "indexes":
+			indexes(os.Args[2:])
+			return
+		case "lint":
+			lint(os.Args[2:])
+			return
+		case "connections":
+			connections(os.Args[2:])
+			return
+		}
+	}
+	check(os.Args[1:])
+}
+
+// check parses the log and prints the lines that fail to parse
+func check(args []string) {
+	file := openLog(args)
+	defer file.Close()
+	parser := newParser()
 
 	total_lines := 0
 	parse_errors := 0
-	for scanner.Scan() {
-		logLine := scanner.Text()
+	for result := range parser.ParseStream(context.Background(), file, runtime.NumCPU()) {
+		if result.LineNumber == 0 {
+			panic(result.Err)
+		}
 		total_lines++
 
-		logEntry, err := mongolog.ParseLogEntry(parser, logLine)
+		logEntry, err := result.Entry, result.Err
 		if err != nil {
-			fmt.Printf("error parsing: %v\n", logLine)
-			fmt.Printf("%s\n", err)
+			fmt.Printf("error parsing line %d: %s\n", result.LineNumber, err)
+			if perr, ok := err.(*mongolog.ParseError); ok && perr.Offset >= 0 {
+				fmt.Printf("%s\n\n", perr.Snippet())
+			} else {
+				fmt.Printf("%v\n\n", result.LogLine)
+			}
 			parse_errors++
 		} else {
 			chop := len(logEntry.LogMessage)
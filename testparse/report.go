@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mpihlak/mongolog"
+)
+
+// report prints the slow queries of the log aggregated by namespace and query shape
+func report(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	sortBy := flags.String("sort", "total", "column to sort by: "+strings.Join(mongolog.QueryStatsColumns(), ", "))
+	limit := flags.Int("n", 0, "show only the first n queries")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s report [-sort column] [-n limit] [logfile]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	file := openLog(flags.Args())
+	defer file.Close()
+	parser := newParser()
+
+	queries := mongolog.NewQueryReport()
+	for result := range parser.ParseStream(context.Background(), file, runtime.NumCPU()) {
+		if result.LineNumber == 0 {
+			panic(result.Err)
+		}
+		if result.Err == nil {
+			queries.Add(&result.Entry)
+		}
+	}
+
+	stats, err := queries.Queries(*sortBy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *limit > 0 && *limit < len(stats) {
+		stats = stats[:*limit]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "namespace\tcommand\tcount\ttotal\tmin\tmean\tp95\tmax\tdocsExamined\tkeysExamined\tnreturned\tplans\tshape")
+	for _, q := range stats {
+		fmt.Fprintf(w, "%v\t%v\t%d\t%v\t%v\t%v\t%v\t%v\t%d\t%d\t%d\t%v\t%v\n",
+			q.Shape.Namespace, q.Shape.Command, q.Count, q.Total.Round(time.Millisecond),
+			q.Min(), q.Mean().Round(time.Millisecond), q.Percentile(95), q.Max(),
+			q.DocsExamined, q.KeysExamined, q.NReturned,
+			strings.Join(q.PlanSummaries(), "; "), q.Shape.Pattern())
+	}
+	w.Flush()
+}
@@ -0,0 +1,33 @@
+package mongolog
+
+import (
+	"fmt"
+	"time"
+)
+
+// The timestamp formats of mongod --timeStampFormat. The fractional seconds are optional, time.Parse
+// accepts them without them being in the layout.
+const (
+	// iso8601-utc: 2018-10-05T14:01:04.067Z, also the JSON logs with a local offset: +02:00
+	timestampLayoutISO8601 = "2006-01-02T15:04:05Z07:00"
+	// iso8601-local: 2018-10-05T14:01:04.067+0000
+	timestampLayoutISO8601Local = "2006-01-02T15:04:05-0700"
+	// ctime: Fri Oct  5 14:01:04.067, no year and no zone
+	timestampLayoutCtime = "Mon Jan _2 15:04:05"
+)
+
+// ParseTimestamp parses the mongod log timestamp in any of the iso8601-utc, iso8601-local and
+// ctime formats. The ctime timestamps have no year nor zone, these are taken from year and loc.
+func ParseTimestamp(timestamp string, year int, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{timestampLayoutISO8601, timestampLayoutISO8601Local} {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.Parse(timestampLayoutCtime, timestamp)
+	if err != nil {
+		return t, fmt.Errorf("unknown timestamp format: %q", timestamp)
+	}
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+}
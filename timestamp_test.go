@@ -0,0 +1,83 @@
+package mongolog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	helsinki := time.FixedZone("EET", 2*3600)
+	expect := time.Date(2018, 10, 5, 14, 1, 4, 67000000, time.UTC)
+
+	testMessages := []struct {
+		timestamp string
+		expect    time.Time
+	}{
+		{"2018-10-05T14:01:04.067Z", expect},
+		{"2018-10-05T14:01:04.067+0000", expect},
+		{"2018-10-05T16:01:04.067+0200", expect},
+		{"2018-10-05T16:01:04.067+02:00", expect},
+		{"2018-10-05T14:01:04Z", expect.Truncate(time.Second)},
+		{"Fri Oct  5 14:01:04.067", expect},
+		{"Fri Oct  5 14:01:04", expect.Truncate(time.Second)},
+		{"Mon Oct 15 14:01:04.067", expect.AddDate(0, 0, 10)},
+	}
+
+	for _, v := range testMessages {
+		ts, err := ParseTimestamp(v.timestamp, 2018, time.UTC)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", v.timestamp, err)
+			continue
+		}
+		if !ts.Equal(v.expect) {
+			t.Errorf("%v: expected %v, got %v", v.timestamp, v.expect, ts)
+		}
+	}
+
+	ts, _ := ParseTimestamp("Fri Oct  5 16:01:04.067", 2018, helsinki)
+	if !ts.Equal(expect) || ts.Location() != helsinki {
+		t.Errorf("ctime default zone not used: %v", ts)
+	}
+
+	for _, v := range []string{"", "2018-10-05", "yesterday", "Fri Oct  5"} {
+		if _, err := ParseTimestamp(v, 2018, time.UTC); err == nil {
+			t.Errorf("%v: expected an error", v)
+		}
+	}
+}
+
+func TestParseLogEntryTime(t *testing.T) {
+	parser, _ := NewLogParserWithOptions(LogParserOptions{DefaultYear: 2018, DefaultLocation: time.UTC})
+	expect := time.Date(2018, 10, 5, 14, 1, 4, 67000000, time.UTC)
+
+	for _, logLine := range []string{
+		`2018-10-05T14:01:04.067Z I NETWORK  [listener] connection accepted from 10.0.0.1:47878 #1` +
+			` (1 connection now open)`,
+		`2018-10-05T17:01:04.067+0300 I NETWORK  [listener] connection accepted from 10.0.0.1:47878 #1` +
+			` (1 connection now open)`,
+		`Fri Oct  5 14:01:04.067 I NETWORK  [listener] connection accepted from 10.0.0.1:47878 #1` +
+			` (1 connection now open)`,
+		`{"t":{"$date":"2018-10-05T14:01:04.067+00:00"},"s":"I",  "c":"NETWORK",  "id":22943,` +
+			` "ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.1:47878","connectionId":1}}`,
+	} {
+		m, err := parser.Parse(logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", logLine, err)
+			continue
+		}
+		if !m.Time.Equal(expect) || m.Context != "[listener]" || m.Component != "NETWORK" {
+			t.Errorf("unexpected entry: %v %v %v", m.Time, m.Context, m.Component)
+		}
+	}
+
+	// The entry is kept without the time in the strict mode too
+	m, err := parser.Parse(`yesterday I NETWORK  [listener] connection accepted`)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !m.Time.IsZero() || m.Timestamp != "yesterday" || m.Component != "NETWORK" {
+		t.Errorf("unexpected entry: %v %v %v", m.Time, m.Timestamp, m.Component)
+	} else if len(m.Warnings) != 1 || m.Warnings[0].Stage != StageHeader ||
+		m.Warnings[0].Token != "yesterday" {
+		t.Errorf("unexpected warnings: %v", m.Warnings)
+	}
+}
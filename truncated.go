@@ -0,0 +1,194 @@
+package mongolog
+
+import (
+	"strings"
+)
+
+// Mongo puts this between the beginning and the end of a log line that was too long
+const truncationSeparator = " .......... "
+
+// extractEntryDocument extracts the document at start of the log message, like ExtractDocument.
+// The truncated entries are only searched up to where the message was cut, and a document that
+// was cut is closed up with what's available of it. end is where the rest of the message
+// continues, ie. the plan summary and the execution stats.
+func extractEntryDocument(entry *MongoLogEntry, start int) (doc string, end int, ok bool) {
+	message := entry.LogMessage
+	cut := -1
+	if entry.Truncated {
+		cut = strings.Index(message, truncationSeparator)
+	}
+	if cut < start {
+		doc, ok = ExtractDocument(message, start)
+		return doc, start + len(doc), ok
+	}
+
+	if doc, ok = ExtractDocument(message[:cut], start); ok {
+		return doc, start + len(doc), ok
+	}
+	if start >= cut || message[start] != '{' {
+		return "", start, false
+	}
+	doc, _ = repairTruncatedDocument(message[start:cut], true)
+	return doc, cut + len(truncationSeparator), true
+}
+
+// repairTruncatedDocument makes a parseable document of one that Mongo has truncated. The "..."
+// markers that stand for the left out elements are blanked out along with their keys. If cut is
+// set the document is missing its end, the incomplete trailing elements are dropped and the open
+// brackets closed. The offsets of what's kept stay the same. Reports whether anything was done.
+func repairTruncatedDocument(doc string, cut bool) (repaired string, truncated bool) {
+	if cut {
+		doc = dropUnterminatedString(doc)
+	}
+
+	tokens, _ := tokenize(doc, make([]token, 0, len(doc)/4))
+	text := func(t token) string {
+		return doc[t.start:t.end]
+	}
+	isPunct := func(kept []token, s string) bool {
+		return len(kept) > 0 && kept[len(kept)-1].typ == tokPunct && text(kept[len(kept)-1]) == s
+	}
+
+	buf := []byte(doc)
+	blank := func(t token) {
+		for i := t.start; i < t.end; i++ {
+			buf[i] = ' '
+		}
+	}
+
+	// dropKey drops the key of a key: value pair, the colon is already gone
+	dropKey := func(kept []token) []token {
+		for len(kept) > 0 && kept[len(kept)-1].typ == tokIdent {
+			blank(kept[len(kept)-1])
+			kept = kept[:len(kept)-1]
+			if !isPunct(kept, ".") {
+				break
+			}
+			blank(kept[len(kept)-1])
+			kept = kept[:len(kept)-1]
+		}
+		if isPunct(kept, "$") {
+			blank(kept[len(kept)-1])
+			kept = kept[:len(kept)-1]
+		}
+		return kept
+	}
+
+	kept := make([]token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if !isEllipsis(doc, tokens, i) {
+			kept = append(kept, tokens[i])
+			continue
+		}
+
+		truncated = true
+		for _, t := range tokens[i : i+3] {
+			blank(t)
+		}
+		i += 2
+
+		if isPunct(kept, ":") {
+			blank(kept[len(kept)-1])
+			kept = dropKey(kept[:len(kept)-1])
+		}
+		if isPunct(kept, ",") {
+			blank(kept[len(kept)-1])
+			kept = kept[:len(kept)-1]
+		}
+	}
+
+	if !cut {
+		return string(buf), truncated
+	}
+
+	// Drop whatever is left incomplete at the end
+	for len(kept) > 0 && isIncomplete(text(kept[len(kept)-1]), kept[len(kept)-1].typ) {
+		if isPunct(kept, ":") {
+			kept = dropKey(kept[:len(kept)-1])
+		} else {
+			kept = kept[:len(kept)-1]
+		}
+	}
+
+	var closers []string
+	for _, t := range kept {
+		if t.typ != tokPunct {
+			continue
+		}
+		switch text(t) {
+		case "{":
+			closers = append(closers, "}")
+		case "[":
+			closers = append(closers, "]")
+		case "(":
+			closers = append(closers, ")")
+		case "}", "]", ")":
+			if len(closers) > 0 {
+				closers = closers[:len(closers)-1]
+			}
+		}
+	}
+
+	end := 0
+	if len(kept) > 0 {
+		end = kept[len(kept)-1].end
+	}
+	var result strings.Builder
+	result.Write(buf[:end])
+	for i := len(closers) - 1; i >= 0; i-- {
+		result.WriteString(" " + closers[i])
+	}
+	return result.String(), true
+}
+
+// isIncomplete reports whether the document can't end with the token, not counting the brackets
+// that will be closed
+func isIncomplete(s string, typ tokenType) bool {
+	switch typ {
+	case tokIdent:
+		return s != "true" && s != "false" && s != "null"
+	case tokPunct:
+		return s != "{" && s != "[" && s != "}" && s != "]" && s != ")"
+	}
+	return false
+}
+
+// isEllipsis reports whether the tokens at i are the three dots that Mongo leaves in place of
+// the elements that didn't fit
+func isEllipsis(doc string, tokens []token, i int) bool {
+	if i+2 >= len(tokens) {
+		return false
+	}
+	for j := i; j < i+3; j++ {
+		if tokens[j].typ != tokPunct || doc[tokens[j].start:tokens[j].end] != "." {
+			return false
+		}
+		if j > i && tokens[j].start != tokens[j-1].end {
+			return false
+		}
+	}
+	return true
+}
+
+// dropUnterminatedString cuts the document before the string that was cut in the middle
+func dropUnterminatedString(doc string) string {
+	var quote byte
+	start := 0
+	for i := 0; i < len(doc); i++ {
+		c := doc[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote, start = c, i
+		}
+	}
+	if quote != 0 {
+		return doc[:start]
+	}
+	return doc
+}
@@ -0,0 +1,125 @@
+package mongolog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRepairTruncatedDocument(t *testing.T) {
+	testMessages := []struct {
+		doc    string
+		cut    bool
+		expect string
+	}{
+		{`{ a: 1, b: [ 1, 2, ... ], c: { d: ... } }`, false, `{ a: 1, b: [ 1, 2      ], c: {        } }`},
+		{`{ a: 1, ... }`, false, `{ a: 1      }`},
+		{`{ a: "...", b: 1 }`, false, `{ a: "...", b: 1 }`},
+		{`{ a: 1, b: { c: "abc`, true, `{ a: 1, b: { } }`},
+		{`{ a: 1, b: [ 1, 2`, true, `{ a: 1, b: [ 1, 2 ] }`},
+		{`{ a: 1, b: [ 1, 2, `, true, `{ a: 1, b: [ 1, 2 ] }`},
+		{`{ a: 1, b.c.d`, true, `{ a: 1 }`},
+		{`{ a: 1, $b: ObjectId('5a8c`, true, `{ a: 1 }`},
+		{`{ a: true, b: new Date(`, true, `{ a: true }`},
+		{`{ a: Timestamp(1538979514, 7`, true, `{ a: Timestamp(1538979514, 7 ) }`},
+		{`{ a: [ { b: 1 }, ... ], c: tr`, true, `{ a: [ { b: 1 }      ] }`},
+	}
+
+	for _, v := range testMessages {
+		repaired, truncated := repairTruncatedDocument(v.doc, v.cut)
+		if repaired != v.expect {
+			t.Errorf("%v: expected %q, got %q", v.doc, v.expect, repaired)
+		}
+		if truncated != (v.doc != v.expect) {
+			t.Errorf("%v: unexpected truncated %v", v.doc, truncated)
+		}
+	}
+}
+
+func TestParseTruncatedEntry(t *testing.T) {
+	logLine := `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] warning: log line attempted (12kB)` +
+		` over max size (10kB), printing beginning and end ... command FooDb.foo command: aggregate` +
+		` { aggregate: "foo", pipeline: [ { $match: { a: 1, b: "xyz .......... 00" } } ], cursor: {} }` +
+		` planSummary: IXSCAN { a: 1 } keysExamined:10 docsExamined:10 numYields:0 nreturned:1` +
+		` reslen:100 locks:{ Global: { acquireCount: { r: 2 } } } protocol:op_msg 1234ms`
+
+	for _, fast := range []bool{false, true} {
+		parser, _ := NewLogParserWithOptions(LogParserOptions{FastPseudoJson: fast})
+		m, err := parser.Parse(logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+
+		if !m.Truncated || m.OriginalSize != 12*1024 {
+			t.Errorf("expected truncated entry, got %v %v", m.Truncated, m.OriginalSize)
+		}
+		if m.Command != "aggregate" || m.Namespace != "FooDb.foo" {
+			t.Errorf("unexpected command %v on %v", m.Command, m.Namespace)
+		}
+		if n, ok := m.CommandParameters.GetNumber("pipeline.0.$match.a"); !ok || n != 1 {
+			t.Errorf("pipeline.0.$match.a mismatch, got %v %v", n, ok)
+		}
+		if m.CommandParameters.Has("pipeline.0.$match.b") || m.CommandParameters.Has("cursor") {
+			t.Errorf("unexpected parameters: %v", m.CommandParameters.Keys())
+		}
+		if m.PlanInfo == nil || m.PlanInfo.String() != "IXSCAN { a: 1 }" {
+			t.Errorf("unexpected plan: %v", m.PlanInfo)
+		}
+		if m.ExecStats == nil || m.ExecStats.Duration != 1234*time.Millisecond || m.ExecStats.NReturned != 1 {
+			t.Errorf("unexpected exec stats: %+v", m.ExecStats)
+		}
+		if m.Locks.WaitMicros("Global") != 0 || len(m.Locks) != 1 {
+			t.Errorf("unexpected locks: %v", m.Locks)
+		}
+	}
+}
+
+func TestParseTruncatedDocuments(t *testing.T) {
+	testMessages := []struct {
+		logLine   string
+		truncated bool
+	}{
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.foo command: insert` +
+				` { insert: "foo", documents: [ { a: 1 }, { a: 2 }, ... ], ordered: true } ninserted:2` +
+				` keysInserted:2 numYields:0 reslen:100 locks:{} protocol:op_msg 3ms`,
+			truncated: true,
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I WRITE    [conn1] update FooDb.foo query: { a: 1, ... }` +
+				` planSummary: COLLSCAN update: { $set: { b: "..." } } keysExamined:0 docsExamined:1` +
+				` nMatched:1 nModified:1 numYields:0 locks:{} 0ms`,
+			truncated: true,
+		},
+		{
+			logLine: `2018-10-05T14:01:04.067+0000 I COMMAND  [conn1] command FooDb.foo command: find` +
+				` { find: "foo", comment: "loading..." } planSummary: COLLSCAN keysExamined:0` +
+				` docsExamined:1 nreturned:1 reslen:100 locks:{} protocol:op_msg 3ms`,
+			truncated: false,
+		},
+	}
+
+	parser, _ := NewLogParser()
+	for _, v := range testMessages {
+		m, err := parser.Parse(v.logLine)
+		if err != nil {
+			t.Errorf("unexpected error: %v: %v", v.logLine, err)
+			continue
+		}
+		if m.Truncated != v.truncated || m.OriginalSize != 0 {
+			t.Errorf("%v: unexpected truncated %v %v", v.logLine, m.Truncated, m.OriginalSize)
+		}
+	}
+
+	m, _ := parser.Parse(testMessages[0].logLine)
+	if docs := m.CommandParameters.Get("documents"); docs == nil || len(docs.ArrayValue) != 2 {
+		t.Errorf("unexpected documents: %+v", docs)
+	}
+	if b, ok := m.CommandParameters.GetBool("ordered"); !ok || !b {
+		t.Errorf("ordered mismatch, got %v %v", b, ok)
+	}
+	m, _ = parser.Parse(testMessages[1].logLine)
+	if s, ok := m.CommandParameters.GetString("update.$set.b"); !ok || s != "..." {
+		t.Errorf("update.$set.b mismatch, got %v %v", s, ok)
+	}
+}